@@ -7,12 +7,34 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/Monkhai/strixos-server.git/internal/game"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
 	"github.com/Monkhai/strixos-server.git/internal/server"
 )
 
+const (
+	IDENTITY_STORE_PATH = "data/identities.json"
+	PROFILE_STORE_PATH  = "data/profiles.json"
+	SESSION_KEY_ENV     = "STRIXOS_SESSION_KEY"
+	// QUEUE_BEST_OF_ENV makes matchmade games best-of-N series
+	QUEUE_BEST_OF_ENV = "STRIXOS_QUEUE_BEST_OF"
+	// TIME_CONTROL_ENV sets the clocks of matchmade and bot games: "untimed",
+	// "<minutes>+<seconds>" or "<seconds>/turn"
+	TIME_CONTROL_ENV = "STRIXOS_TIME_CONTROL"
+	// BOT_BACKFILL_ENV is how long a lone player waits in the queue before a
+	// bot is matched against them, as a Go duration such as "45s"; "0"
+	// disables backfill
+	BOT_BACKFILL_ENV = "STRIXOS_BOT_BACKFILL_AFTER"
+	// BLOCKED_WORDS_PATH is an optional word list, one word per line, that
+	// display names may not contain
+	BLOCKED_WORDS_PATH = "data/blocked_words.txt"
+)
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	signalChan := make(chan os.Signal, 1)
@@ -20,10 +42,64 @@ func main() {
 	defer cancel()
 	var wg sync.WaitGroup
 	var s = server.NewServer(&ctx, &wg)
+	store, err := identity.NewFileIdentityStore(IDENTITY_STORE_PATH)
+	if err != nil {
+		log.Fatalf("error loading identities: %s", err)
+	}
+	s.IdentityManager = identity.NewIdentityManager(store)
+	s.IdentityManager.Progress = s.AvatarProgress
+	if s.Profiles, err = game.LoadProfileStore(PROFILE_STORE_PATH); err != nil {
+		log.Fatalf("error loading profiles: %s", err)
+	}
+	if filter, err := identity.LoadWordFilter(BLOCKED_WORDS_PATH); err == nil {
+		s.IdentityManager.Names.Filter = filter
+	} else if !os.IsNotExist(err) {
+		log.Fatalf("error loading blocked words: %s", err)
+	}
+	if key := os.Getenv(SESSION_KEY_ENV); key != "" {
+		s.Sessions = identity.NewTokenIssuer([]byte(key), identity.SESSION_TOKEN_TTL)
+	} else {
+		log.Printf("%s is not set, session tokens will not survive a restart\n", SESSION_KEY_ENV)
+	}
+	if value := os.Getenv(QUEUE_BEST_OF_ENV); value != "" {
+		bestOf, err := strconv.Atoi(value)
+		if err == nil {
+			err = game.ValidateSeriesLength(bestOf)
+		}
+		if err != nil {
+			log.Fatalf("invalid %s %q: %s", QUEUE_BEST_OF_ENV, value, err)
+		}
+		s.QueueBestOf = bestOf
+	}
+	if value := os.Getenv(TIME_CONTROL_ENV); value != "" {
+		control, err := game.ParseTimeControl(value)
+		if err != nil {
+			log.Fatalf("invalid %s %q: %s", TIME_CONTROL_ENV, value, err)
+		}
+		s.Rules.TimeControl = control
+	}
+	if value := os.Getenv(BOT_BACKFILL_ENV); value != "" {
+		after, err := time.ParseDuration(value)
+		if err == nil && after < 0 {
+			err = fmt.Errorf("backfill wait cannot be negative")
+		}
+		if err != nil {
+			log.Fatalf("invalid %s %q: %s", BOT_BACKFILL_ENV, value, err)
+		}
+		s.BotBackfillAfter = after
+	}
+	s.RestoreSnapshots()
 
-	wg.Add(1)
+	wg.Add(2 + server.ANALYSIS_WORKERS)
 	go s.QueueLoop(ctx, &wg)
+	go s.SnapshotLoop(ctx, &wg)
+	for range server.ANALYSIS_WORKERS {
+		go s.AnalysisWorker(ctx, &wg)
+	}
 	http.HandleFunc("/ws", s.WebSocketHandler)
+	http.HandleFunc("/replay", s.ReplayHandler)
+	http.HandleFunc("/avatars", s.AvatarsHandler)
+	http.HandleFunc("/profile", s.ProfileHandler)
 
 	go func() {
 		fmt.Println("Server started on :8080")
@@ -33,6 +109,7 @@ func main() {
 	<-signalChan
 
 	fmt.Println("\nShutting down gracefully...")
+	s.SaveSnapshots()
 	cancel()
 
 	fmt.Println("\nCancel Called")
@@ -2,4 +2,7 @@ module github.com/Monkhai/strixos-server.git
 
 go 1.23
 
-require github.com/gorilla/websocket v1.5.3
+require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/text v0.21.0
+)
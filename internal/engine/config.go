@@ -0,0 +1,58 @@
+package engine
+
+import "fmt"
+
+type DecayMode string
+
+const (
+	DECAY_PER_MOVE  DecayMode = "perMove"
+	DECAY_PER_ROUND DecayMode = "perRound"
+	DECAY_OFF       DecayMode = "off"
+)
+
+// Config holds everything the rules need to play a game. A MaxMoves of zero
+// means there is no move cap.
+type Config struct {
+	Rows         int
+	Cols         int
+	WinLength    int
+	InitialLives int
+	Decay        DecayMode
+	MaxMoves     int
+}
+
+// Validate only checks that the rules make sense. Product limits such as the
+// largest allowed board are enforced by the caller.
+func (c Config) Validate() error {
+	if c.Rows < 1 || c.Cols < 1 {
+		return fmt.Errorf("%w: board must have at least one row and column", ErrInvalidConfig)
+	}
+	if c.WinLength < 1 || c.WinLength > max(c.Rows, c.Cols) {
+		return fmt.Errorf("%w: win length %d does not fit the board", ErrInvalidConfig, c.WinLength)
+	}
+	if c.InitialLives < 0 {
+		return fmt.Errorf("%w: initial lives cannot be negative", ErrInvalidConfig)
+	}
+	switch c.Decay {
+	case DECAY_PER_MOVE, DECAY_PER_ROUND, DECAY_OFF:
+	default:
+		return fmt.Errorf("%w: unknown decay mode %q", ErrInvalidConfig, c.Decay)
+	}
+	if c.MaxMoves < 0 {
+		return fmt.Errorf("%w: max moves cannot be negative", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// ShouldDecay reports whether pieces lose a life after the given move.
+// moveCount is the number of moves played so far, including this one.
+func (c Config) ShouldDecay(moveCount int) bool {
+	switch c.Decay {
+	case DECAY_PER_MOVE:
+		return true
+	case DECAY_PER_ROUND:
+		return moveCount%2 == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,159 @@
+// Package engine implements the vanishing-piece tic tac toe rules as pure
+// functions over immutable states. It has no locks and no I/O, so the live
+// game, bots, replays and analysis can all share it.
+package engine
+
+type EventType string
+
+const (
+	EVENT_PLACED   EventType = "placed"
+	EVENT_DECAYED  EventType = "decayed"
+	EVENT_VANISHED EventType = "vanished"
+	EVENT_WON      EventType = "won"
+	EVENT_DREW     EventType = "drew"
+)
+
+// Event describes one thing that happened while applying a move. Row and Col
+// are set for events about a single cell, Line for a win and Reason for the
+// end of the game.
+type Event struct {
+	Type   EventType `json:"type"`
+	Mark   string    `json:"mark,omitempty"`
+	Row    int       `json:"row"`
+	Col    int       `json:"col"`
+	Lives  int       `json:"lives"`
+	Line   []Move    `json:"line,omitempty"`
+	Reason Reason    `json:"reason,omitempty"`
+}
+
+// directions to scan for a line: right, down, down-right and down-left.
+var lineDirections = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// Apply plays move for the side to move and returns the resulting state and
+// everything that happened. The pieces are placed, then decayed, then the
+// game end conditions are checked. s is never modified.
+func Apply(s State, move Move) (State, []Event, error) {
+	if s.result != nil {
+		return s, nil, ErrGameOver
+	}
+	if !s.InBounds(move.Row, move.Col) {
+		return s, nil, ErrOutOfBounds
+	}
+	if s.Cell(move.Row, move.Col).Value != EMPTY {
+		return s, nil, ErrCellOccupied
+	}
+
+	mark := s.toMove
+	next := s
+	next.cells = append([]Cell(nil), s.cells...)
+	next.cells[move.Row*s.config.Cols+move.Col] = Cell{Value: mark, Lives: s.config.InitialLives}
+	next.moveCount++
+	next.toMove = OtherMark(mark)
+	events := []Event{{Type: EVENT_PLACED, Mark: mark, Row: move.Row, Col: move.Col, Lives: s.config.InitialLives}}
+
+	if s.config.ShouldDecay(next.moveCount) {
+		events = next.decay(events)
+	}
+
+	if line, winner, ok := next.findLine(); ok {
+		for _, m := range line {
+			next.cells[m.Row*s.config.Cols+m.Col].WinState = true
+		}
+		next.result = &Result{Winner: winner, Reason: REASON_WIN}
+		return next, append(events, Event{Type: EVENT_WON, Mark: winner, Line: line, Reason: REASON_WIN}), nil
+	}
+
+	key := next.Key()
+	next.history = &position{key: key, prev: s.history}
+	switch {
+	case next.isFull():
+		next.result = &Result{Reason: REASON_FULL_BOARD}
+	case s.config.MaxMoves > 0 && next.moveCount >= s.config.MaxMoves:
+		next.result = &Result{Reason: REASON_MOVE_LIMIT}
+	case next.repetitions(key) >= REPETITION_LIMIT:
+		next.result = &Result{Reason: REASON_REPETITION}
+	}
+	if next.result != nil {
+		events = append(events, Event{Type: EVENT_DREW, Reason: next.result.Reason})
+	}
+	return next, events, nil
+}
+
+// decay ages every piece on a board the caller already owns. Pieces with no
+// lives left vanish.
+func (s *State) decay(events []Event) []Event {
+	for i, cell := range s.cells {
+		if cell.Value == EMPTY {
+			continue
+		}
+		row, col := i/s.config.Cols, i%s.config.Cols
+		if cell.Lives == 0 {
+			s.cells[i] = Cell{Value: EMPTY, Lives: s.config.InitialLives}
+			events = append(events, Event{Type: EVENT_VANISHED, Mark: cell.Value, Row: row, Col: col})
+			continue
+		}
+		s.cells[i].Lives--
+		events = append(events, Event{Type: EVENT_DECAYED, Mark: cell.Value, Row: row, Col: col, Lives: cell.Lives - 1})
+	}
+	return events
+}
+
+func (s State) findLine() ([]Move, string, bool) {
+	k := s.config.WinLength
+	for i := range s.config.Rows {
+		for j := range s.config.Cols {
+			mark := s.Cell(i, j).Value
+			if mark == EMPTY {
+				continue
+			}
+			for _, d := range lineDirections {
+				if !s.InBounds(i+d[0]*(k-1), j+d[1]*(k-1)) {
+					continue
+				}
+				n := 1
+				for n < k && s.Cell(i+d[0]*n, j+d[1]*n).Value == mark {
+					n++
+				}
+				if n < k {
+					continue
+				}
+
+				line := make([]Move, k)
+				for step := range k {
+					line[step] = Move{Row: i + d[0]*step, Col: j + d[1]*step}
+				}
+				return line, mark, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func (s State) isFull() bool {
+	for _, cell := range s.cells {
+		if cell.Value == EMPTY {
+			return false
+		}
+	}
+	return true
+}
+
+// Lines calls fn for every run of WinLength cells on the board. It is meant
+// for evaluation functions that score partial lines.
+func (s State) Lines(fn func(cells []Cell)) {
+	k := s.config.WinLength
+	window := make([]Cell, k)
+	for i := range s.config.Rows {
+		for j := range s.config.Cols {
+			for _, d := range lineDirections {
+				if !s.InBounds(i+d[0]*(k-1), j+d[1]*(k-1)) {
+					continue
+				}
+				for step := range k {
+					window[step] = s.Cell(i+d[0]*step, j+d[1]*step)
+				}
+				fn(window)
+			}
+		}
+	}
+}
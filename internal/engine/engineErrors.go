@@ -0,0 +1,10 @@
+package engine
+
+import "errors"
+
+var (
+	ErrInvalidConfig = errors.New("invalid engine config")
+	ErrGameOver      = errors.New("game is already over")
+	ErrOutOfBounds   = errors.New("move is out of bounds")
+	ErrCellOccupied  = errors.New("cell is occupied")
+)
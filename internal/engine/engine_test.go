@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testConfig(initialLives int, decay DecayMode, maxMoves int) Config {
+	return Config{Rows: 3, Cols: 3, WinLength: 3, InitialLives: initialLives, Decay: decay, MaxMoves: maxMoves}
+}
+
+// play applies moves in order from the starting position and returns the
+// final state together with the events of the last move.
+func play(t *testing.T, config Config, moves ...Move) (State, []Event) {
+	t.Helper()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	s := NewState(config)
+	var events []Event
+	for i, move := range moves {
+		var err error
+		s, events, err = Apply(s, move)
+		if err != nil {
+			t.Fatalf("move %d %+v: %v", i+1, move, err)
+		}
+	}
+	return s, events
+}
+
+func hasEvent(events []Event, want Event) bool {
+	for _, e := range events {
+		if e.Type == want.Type && e.Mark == want.Mark && e.Row == want.Row && e.Col == want.Col && e.Lives == want.Lives {
+			return true
+		}
+	}
+	return false
+}
+
+func TestApplyWinLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []Move
+		line  []Move
+	}{
+		{
+			name:  "row",
+			moves: []Move{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}},
+			line:  []Move{{0, 0}, {0, 1}, {0, 2}},
+		},
+		{
+			name:  "column",
+			moves: []Move{{0, 0}, {0, 1}, {1, 0}, {1, 1}, {2, 0}},
+			line:  []Move{{0, 0}, {1, 0}, {2, 0}},
+		},
+		{
+			name:  "diagonal",
+			moves: []Move{{0, 0}, {0, 1}, {1, 1}, {0, 2}, {2, 2}},
+			line:  []Move{{0, 0}, {1, 1}, {2, 2}},
+		},
+		{
+			name:  "anti-diagonal",
+			moves: []Move{{0, 2}, {0, 0}, {1, 1}, {0, 1}, {2, 0}},
+			line:  []Move{{0, 2}, {1, 1}, {2, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, events := play(t, testConfig(6, DECAY_OFF, 0), tt.moves...)
+			result, over := s.Result()
+			if !over || result.Winner != MARK_X || result.Reason != REASON_WIN {
+				t.Fatalf("Result() = %+v, %v, want x to win", result, over)
+			}
+			last := events[len(events)-1]
+			if last.Type != EVENT_WON || len(last.Line) != len(tt.line) {
+				t.Fatalf("last event = %+v, want a win along %v", last, tt.line)
+			}
+			for _, m := range tt.line {
+				if !s.Cell(m.Row, m.Col).WinState {
+					t.Errorf("cell %+v is not marked as part of the win", m)
+				}
+			}
+			if _, _, err := Apply(s, Move{Row: 2, Col: 1}); !errors.Is(err, ErrGameOver) {
+				t.Errorf("Apply after the win = %v, want %v", err, ErrGameOver)
+			}
+		})
+	}
+}
+
+func TestApplyRejectsIllegalMoves(t *testing.T) {
+	s, _ := play(t, testConfig(6, DECAY_OFF, 0), Move{Row: 1, Col: 1})
+	if _, _, err := Apply(s, Move{Row: 3, Col: 0}); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("Apply out of bounds = %v, want %v", err, ErrOutOfBounds)
+	}
+	if _, _, err := Apply(s, Move{Row: 1, Col: 1}); !errors.Is(err, ErrCellOccupied) {
+		t.Errorf("Apply on an occupied cell = %v, want %v", err, ErrCellOccupied)
+	}
+}
+
+func TestApplyDecaysAndVanishesPerMove(t *testing.T) {
+	config := testConfig(1, DECAY_PER_MOVE, 0)
+
+	s, events := play(t, config, Move{Row: 0, Col: 0})
+	if !hasEvent(events, Event{Type: EVENT_DECAYED, Mark: MARK_X, Row: 0, Col: 0, Lives: 0}) {
+		t.Errorf("events = %+v, want the new piece to decay right away", events)
+	}
+	if cell := s.Cell(0, 0); cell.Value != MARK_X || cell.Lives != 0 {
+		t.Errorf("Cell(0, 0) = %+v, want x with no lives left", cell)
+	}
+
+	s, events = play(t, config, Move{Row: 0, Col: 0}, Move{Row: 2, Col: 2})
+	if !hasEvent(events, Event{Type: EVENT_VANISHED, Mark: MARK_X, Row: 0, Col: 0}) {
+		t.Errorf("events = %+v, want x at (0, 0) to vanish", events)
+	}
+	if cell := s.Cell(0, 0); cell.Value != EMPTY {
+		t.Errorf("Cell(0, 0) = %+v, want it empty", cell)
+	}
+	if cell := s.Cell(2, 2); cell.Value != MARK_O || cell.Lives != 0 {
+		t.Errorf("Cell(2, 2) = %+v, want o with no lives left", cell)
+	}
+}
+
+func TestApplyDecaysPerRound(t *testing.T) {
+	config := testConfig(1, DECAY_PER_ROUND, 0)
+
+	s, events := play(t, config, Move{Row: 0, Col: 0})
+	if len(events) != 1 || s.Cell(0, 0).Lives != 1 {
+		t.Errorf("after the first move events = %+v, cell = %+v, want no decay", events, s.Cell(0, 0))
+	}
+	if key := s.Key(); !strings.HasPrefix(key, MARK_O+"|r|") {
+		t.Errorf("Key() = %q, want it to record the half finished round", key)
+	}
+
+	s, _ = play(t, config, Move{Row: 0, Col: 0}, Move{Row: 2, Col: 2})
+	if s.Cell(0, 0).Lives != 0 || s.Cell(2, 2).Lives != 0 {
+		t.Errorf("after the round cells = %+v, %+v, want both pieces decayed", s.Cell(0, 0), s.Cell(2, 2))
+	}
+	if key := s.Key(); strings.Contains(key, "|r") {
+		t.Errorf("Key() = %q, want no half finished round", key)
+	}
+
+	s, _ = play(t, config, Move{Row: 0, Col: 0}, Move{Row: 2, Col: 2}, Move{Row: 0, Col: 2})
+	if s.Cell(0, 0).Value != MARK_X {
+		t.Errorf("Cell(0, 0) = %+v, want x to stay until the round ends", s.Cell(0, 0))
+	}
+
+	s, events = play(t, config, Move{Row: 0, Col: 0}, Move{Row: 2, Col: 2}, Move{Row: 0, Col: 2}, Move{Row: 2, Col: 0})
+	for _, want := range []Event{
+		{Type: EVENT_VANISHED, Mark: MARK_X, Row: 0, Col: 0},
+		{Type: EVENT_VANISHED, Mark: MARK_O, Row: 2, Col: 2},
+		{Type: EVENT_DECAYED, Mark: MARK_X, Row: 0, Col: 2, Lives: 0},
+		{Type: EVENT_DECAYED, Mark: MARK_O, Row: 2, Col: 0, Lives: 0},
+	} {
+		if !hasEvent(events, want) {
+			t.Errorf("events = %+v, want %+v", events, want)
+		}
+	}
+	if s.Cell(0, 0).Value != EMPTY || s.Cell(2, 2).Value != EMPTY {
+		t.Errorf("cells = %+v, %+v, want the first round's pieces gone", s.Cell(0, 0), s.Cell(2, 2))
+	}
+}
+
+func TestApplyDrawsOnThreefoldRepetition(t *testing.T) {
+	// with no lives every piece vanishes on the move it is placed, so the
+	// empty board comes back after every round
+	config := testConfig(0, DECAY_PER_MOVE, 0)
+	start := NewState(config).Key()
+	move := Move{Row: 1, Col: 1}
+
+	s, _ := play(t, config, move, move, move)
+	if s.IsOver() {
+		t.Fatalf("game ended after three moves, the start position was only seen twice")
+	}
+
+	s, events := play(t, config, move, move, move, move)
+	if key := s.Key(); key != start {
+		t.Fatalf("Key() = %q, want the start position %q", key, start)
+	}
+	result, over := s.Result()
+	if !over || !result.IsDraw() || result.Reason != REASON_REPETITION {
+		t.Fatalf("Result() = %+v, %v, want a draw by repetition", result, over)
+	}
+	if last := events[len(events)-1]; last.Type != EVENT_DREW || last.Reason != REASON_REPETITION {
+		t.Errorf("last event = %+v, want a draw by repetition", last)
+	}
+}
+
+func TestApplyDrawsAtMoveCap(t *testing.T) {
+	s, events := play(t, testConfig(6, DECAY_OFF, 3), Move{Row: 0, Col: 0}, Move{Row: 1, Col: 1}, Move{Row: 2, Col: 2})
+	result, over := s.Result()
+	if !over || !result.IsDraw() || result.Reason != REASON_MOVE_LIMIT {
+		t.Fatalf("Result() = %+v, %v, want a draw at the move cap", result, over)
+	}
+	if last := events[len(events)-1]; last.Type != EVENT_DREW || last.Reason != REASON_MOVE_LIMIT {
+		t.Errorf("last event = %+v, want a draw at the move cap", last)
+	}
+	if moves := s.LegalMoves(); len(moves) != 0 {
+		t.Errorf("LegalMoves() = %v, want none once the game is over", moves)
+	}
+}
+
+func TestApplyDrawsOnFullBoard(t *testing.T) {
+	// x o x
+	// x o o
+	// o x x
+	s, events := play(t, testConfig(6, DECAY_OFF, 0),
+		Move{Row: 0, Col: 0}, Move{Row: 1, Col: 1}, Move{Row: 0, Col: 2},
+		Move{Row: 0, Col: 1}, Move{Row: 2, Col: 1}, Move{Row: 1, Col: 2},
+		Move{Row: 1, Col: 0}, Move{Row: 2, Col: 0}, Move{Row: 2, Col: 2},
+	)
+	result, over := s.Result()
+	if !over || !result.IsDraw() || result.Reason != REASON_FULL_BOARD {
+		t.Fatalf("Result() = %+v, %v, want a draw on a full board", result, over)
+	}
+	if last := events[len(events)-1]; last.Type != EVENT_DREW || last.Reason != REASON_FULL_BOARD {
+		t.Errorf("last event = %+v, want a draw on a full board", last)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := testConfig(6, DECAY_PER_MOVE, 0)
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want the default config to be valid", err)
+	}
+	invalid := map[string]Config{
+		"no rows":          {Rows: 0, Cols: 3, WinLength: 3, Decay: DECAY_OFF},
+		"long win length":  {Rows: 3, Cols: 3, WinLength: 4, Decay: DECAY_OFF},
+		"negative lives":   {Rows: 3, Cols: 3, WinLength: 3, InitialLives: -1, Decay: DECAY_OFF},
+		"unknown decay":    {Rows: 3, Cols: 3, WinLength: 3, Decay: "sometimes"},
+		"negative max cap": {Rows: 3, Cols: 3, WinLength: 3, Decay: DECAY_OFF, MaxMoves: -1},
+	}
+	for name, config := range invalid {
+		if err := config.Validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: Validate() = %v, want %v", name, err, ErrInvalidConfig)
+		}
+	}
+}
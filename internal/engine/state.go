@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	MARK_X           = "x"
+	MARK_O           = "o"
+	EMPTY            = "-"
+	REPETITION_LIMIT = 3
+)
+
+type Cell struct {
+	Value    string `json:"value"`
+	Lives    int    `json:"lives"`
+	WinState bool   `json:"winState"`
+}
+
+type Move struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type Reason string
+
+const (
+	REASON_WIN        Reason = "win"
+	REASON_FULL_BOARD Reason = "fullBoard"
+	REASON_REPETITION Reason = "repetition"
+	REASON_MOVE_LIMIT Reason = "moveLimit"
+)
+
+// Result is how a game ended. Winner is the winning mark, or empty on a draw.
+type Result struct {
+	Winner string `json:"winner"`
+	Reason Reason `json:"reason"`
+}
+
+func (r Result) IsDraw() bool {
+	return r.Winner == ""
+}
+
+// position links every position reached so far, newest first. States share
+// the chain, so applying a move never copies the history.
+type position struct {
+	key  string
+	prev *position
+}
+
+// State is an immutable snapshot of a game. The zero value is not usable;
+// build one with NewState and advance it with Apply.
+type State struct {
+	config    Config
+	cells     []Cell
+	toMove    string
+	moveCount int
+	history   *position
+	result    *Result
+}
+
+// NewState returns the empty starting position, with x to move. The config
+// must already be valid.
+func NewState(config Config) State {
+	cells := make([]Cell, config.Rows*config.Cols)
+	for i := range cells {
+		cells[i] = Cell{Value: EMPTY, Lives: config.InitialLives}
+	}
+	s := State{
+		config: config,
+		cells:  cells,
+		toMove: MARK_X,
+	}
+	s.history = &position{key: s.Key()}
+	return s
+}
+
+func OtherMark(mark string) string {
+	if mark == MARK_X {
+		return MARK_O
+	}
+	return MARK_X
+}
+
+func (s State) Config() Config {
+	return s.config
+}
+
+func (s State) ToMove() string {
+	return s.toMove
+}
+
+func (s State) MoveCount() int {
+	return s.moveCount
+}
+
+func (s State) InBounds(row, col int) bool {
+	return row >= 0 && row < s.config.Rows && col >= 0 && col < s.config.Cols
+}
+
+func (s State) Cell(row, col int) Cell {
+	return s.cells[row*s.config.Cols+col]
+}
+
+// Cells returns a copy of the board as rows of cells.
+func (s State) Cells() [][]Cell {
+	rows := make([][]Cell, s.config.Rows)
+	for i := range rows {
+		rows[i] = append([]Cell(nil), s.cells[i*s.config.Cols:(i+1)*s.config.Cols]...)
+	}
+	return rows
+}
+
+func (s State) IsOver() bool {
+	return s.result != nil
+}
+
+func (s State) Result() (Result, bool) {
+	if s.result == nil {
+		return Result{}, false
+	}
+	return *s.result, true
+}
+
+// LegalMoves lists every empty cell, or nothing once the game is over.
+func (s State) LegalMoves() []Move {
+	if s.result != nil {
+		return nil
+	}
+	var moves []Move
+	for i, cell := range s.cells {
+		if cell.Value == EMPTY {
+			moves = append(moves, Move{Row: i / s.config.Cols, Col: i % s.config.Cols})
+		}
+	}
+	return moves
+}
+
+// Key identifies the position: every piece with its lives and the side to
+// move. With per-round decay it also records whether a round is half done,
+// since that changes when the next decay happens.
+func (s State) Key() string {
+	var key strings.Builder
+	key.WriteString(s.toMove)
+	if s.config.Decay == DECAY_PER_ROUND && s.moveCount%2 == 1 {
+		key.WriteString("|r")
+	}
+	for _, cell := range s.cells {
+		key.WriteByte('|')
+		key.WriteString(cell.Value)
+		if cell.Value != EMPTY {
+			key.WriteString(strconv.Itoa(cell.Lives))
+		}
+	}
+	return key.String()
+}
+
+func (s State) repetitions(key string) int {
+	count := 0
+	for p := s.history; p != nil; p = p.prev {
+		if p.key == key {
+			count++
+		}
+	}
+	return count
+}
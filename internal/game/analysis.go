@@ -0,0 +1,164 @@
+package game
+
+import (
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+const (
+	ANALYSIS_THINK_TIME = 250 * time.Millisecond
+	// ANALYSIS_GAME_BUDGET is the solver time one game gets. Every move is
+	// analysed; in long games each move gets a share of the budget instead of
+	// the full ANALYSIS_THINK_TIME, and a move whose share runs out still gets
+	// its shallowest search.
+	ANALYSIS_GAME_BUDGET = 10 * time.Second
+	// ANALYSIS_INACCURACY_MARGIN is how far below the best move, in evaluation
+	// points, a move can score before it counts as an inaccuracy. One point
+	// less than an unblocked line of two pieces.
+	ANALYSIS_INACCURACY_MARGIN = 16
+)
+
+type MoveLabel string
+
+const (
+	LABEL_BEST       MoveLabel = "best"
+	LABEL_INACCURACY MoveLabel = "inaccuracy"
+	LABEL_BLUNDER    MoveLabel = "blunder"
+)
+
+// MoveAnalysis grades a single move of a replay. Evaluation is the position
+// after the move, from the point of view of the player who made it.
+type MoveAnalysis struct {
+	Number     int         `json:"number"`
+	Label      MoveLabel   `json:"label"`
+	BestMove   engine.Move `json:"bestMove"`
+	Evaluation Evaluation  `json:"evaluation"`
+	Decisive   bool        `json:"decisive"`
+}
+
+// Analysis is the solver's verdict on a finished game. DecisiveMove is the
+// number of the move after which the winner could no longer be stopped, or 0
+// when the game was not decided on the board.
+type Analysis struct {
+	GameID       string         `json:"gameID"`
+	Moves        []MoveAnalysis `json:"moves"`
+	DecisiveMove int            `json:"decisiveMove"`
+}
+
+// rootScores scores every legal move in state for the side to move, deepening
+// until thinkTime is up and keeping the last depth that finished. Unlike
+// bestMove it searches each move with a full window, so the scores can be
+// compared with each other.
+func (s *botSearch) rootScores(state engine.State, thinkTime time.Duration) map[engine.Move]int {
+	s.deadline = time.Now().Add(thinkTime)
+	moves := orderMoves(state, state.LegalMoves())
+	var scores map[engine.Move]int
+	for depth := 1; depth <= BOT_HARD_MAX_DEPTH; depth++ {
+		candidate := make(map[engine.Move]int, len(moves))
+		for _, move := range moves {
+			candidate[move] = s.scoreMove(state, move, depth, -BOT_WIN_SCORE*2, BOT_WIN_SCORE*2)
+			if s.aborted {
+				break
+			}
+		}
+		if s.aborted && scores != nil {
+			break
+		}
+		// the first depth is always kept, even if it ran past the deadline
+		scores = candidate
+		if s.aborted {
+			break
+		}
+	}
+	return scores
+}
+
+func labelMove(played, best int) MoveLabel {
+	switch {
+	case played >= best:
+		return LABEL_BEST
+	case evaluationFromScore(played) != evaluationFromScore(best):
+		return LABEL_BLUNDER
+	case best-played >= ANALYSIS_INACCURACY_MARGIN:
+		return LABEL_INACCURACY
+	default:
+		return LABEL_BEST
+	}
+}
+
+// Analyse replays the game through the engine and compares every move with
+// what the solver would have played in the same position.
+func Analyse(replay *Replay) *Analysis {
+	analysis := &Analysis{GameID: replay.GameID}
+	state := engine.NewState(EngineConfig(replay.BoardConfig, replay.Rules))
+	thinkTime := ANALYSIS_THINK_TIME
+	if len(replay.Moves) > 0 {
+		thinkTime = min(thinkTime, ANALYSIS_GAME_BUDGET/time.Duration(len(replay.Moves)))
+	}
+	for _, record := range replay.Moves {
+		played := engine.Move{Row: record.Row, Col: record.Col}
+		search := &botSearch{table: make(map[string]tableEntry)}
+		scores := search.rootScores(state, thinkTime)
+		playedScore, ok := scores[played]
+		if !ok {
+			// the replay does not follow the rules, nothing more to say
+			break
+		}
+
+		bestMove, bestScore := played, playedScore
+		for move, score := range scores {
+			if score > bestScore {
+				bestMove, bestScore = move, score
+			}
+		}
+		analysis.Moves = append(analysis.Moves, MoveAnalysis{
+			Number:     record.Number,
+			Label:      labelMove(playedScore, bestScore),
+			BestMove:   bestMove,
+			Evaluation: evaluationFromScore(playedScore),
+		})
+
+		next, _, err := engine.Apply(state, played)
+		if err != nil {
+			break
+		}
+		state = next
+	}
+
+	if replay.Result.Reason == REASON_WIN {
+		analysis.markDecisiveMove(replay)
+	}
+	return analysis
+}
+
+// markDecisiveMove finds the first move after which every position was a
+// proven win for the eventual winner.
+func (a *Analysis) markDecisiveMove(replay *Replay) {
+	decisive := -1
+	for i := len(a.Moves) - 1; i >= 0; i-- {
+		wonFor := EVAL_LOSING
+		if replay.Moves[a.Moves[i].Number-1].PlayerID == replay.Result.WinnerID {
+			wonFor = EVAL_WINNING
+		}
+		if a.Moves[i].Evaluation != wonFor {
+			break
+		}
+		decisive = i
+	}
+	if decisive < 0 {
+		return
+	}
+	a.Moves[decisive].Decisive = true
+	a.DecisiveMove = a.Moves[decisive].Number
+}
+
+func GameAnalysisMessage(analysis *Analysis) shared.GenericMessage {
+	return shared.GenericMessage{
+		Type: shared.GameAnalysisMessageType,
+		Content: map[string]any{
+			"analysis": analysis,
+		},
+	}
+}
@@ -3,133 +3,109 @@ package game
 import (
 	"fmt"
 	"sync"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
 )
 
 const INITIAL_LIVES = 6
 
-type Cell struct {
-	Value    string `json:"value"`
-	Lives    int    `json:"lives"`
-	WinState bool   `json:"winState"`
-}
-type Row [3]Cell
-type Board struct {
-	Cells [3]Row
-	Mux   *sync.RWMutex
-}
-
-func NewBoard() *Board {
-	return &Board{
-		Cells: [3]Row{
-			{Cell{"-", INITIAL_LIVES, false}, Cell{"-", INITIAL_LIVES, false}, Cell{"-", INITIAL_LIVES, false}},
-			{Cell{"-", INITIAL_LIVES, false}, Cell{"-", INITIAL_LIVES, false}, Cell{"-", INITIAL_LIVES, false}},
-			{Cell{"-", INITIAL_LIVES, false}, Cell{"-", INITIAL_LIVES, false}, Cell{"-", INITIAL_LIVES, false}},
-		},
-		Mux: &sync.RWMutex{},
-	}
-}
+const (
+	MIN_BOARD_SIZE = 3
+	MAX_BOARD_SIZE = 10
+	MIN_WIN_LENGTH = 3
+)
 
-func CheckValidIndex(i int) bool {
-	return i >= 0 && i < 3
+type BoardConfig struct {
+	Rows      int `json:"rows"`
+	Cols      int `json:"cols"`
+	WinLength int `json:"winLength"`
 }
 
-func (b *Board) CheckValidInsertion(row, col int) bool {
-	value, err := b.GetPoint(row, col)
-	return err == nil && value == "-"
-}
+var DefaultBoardConfig = BoardConfig{Rows: 3, Cols: 3, WinLength: 3}
 
-func (b *Board) GetPoint(row, col int) (string, error) {
-	if !CheckValidIndex(row) {
-		return "", fmt.Errorf("row index %d is invalid", row)
+// NewBoardConfig builds a config from client supplied values. Zero values
+// fall back to the default 3x3 connect-3 board.
+func NewBoardConfig(rows, cols, winLength int) (BoardConfig, error) {
+	config := DefaultBoardConfig
+	if rows != 0 {
+		config.Rows = rows
 	}
-	if !CheckValidIndex(col) {
-		return "", fmt.Errorf("column index %d is invalid", col)
+	if cols != 0 {
+		config.Cols = cols
 	}
-
-	b.Mux.RLock()
-	defer b.Mux.RUnlock()
-	return b.Cells[row][col].Value, nil
+	if winLength != 0 {
+		config.WinLength = winLength
+	}
+	return config, config.Validate()
 }
 
-func (b *Board) SetCell(row, col int, mark string) error {
-	if !b.CheckValidInsertion(row, col) {
-		return fmt.Errorf("invalid insertion at row %d, col %d", row, col)
+func (c BoardConfig) Validate() error {
+	if c.Rows < MIN_BOARD_SIZE || c.Rows > MAX_BOARD_SIZE {
+		return fmt.Errorf("%w: rows must be between %d and %d", ErrInvalidBoardConfig, MIN_BOARD_SIZE, MAX_BOARD_SIZE)
+	}
+	if c.Cols < MIN_BOARD_SIZE || c.Cols > MAX_BOARD_SIZE {
+		return fmt.Errorf("%w: cols must be between %d and %d", ErrInvalidBoardConfig, MIN_BOARD_SIZE, MAX_BOARD_SIZE)
+	}
+	if c.WinLength < MIN_WIN_LENGTH || c.WinLength > max(c.Rows, c.Cols) {
+		return fmt.Errorf("%w: win length must be between %d and %d", ErrInvalidBoardConfig, MIN_WIN_LENGTH, max(c.Rows, c.Cols))
 	}
-
-	b.Mux.Lock()
-	defer b.Mux.Unlock()
-	cell := Cell{Value: mark, Lives: INITIAL_LIVES, WinState: false}
-	b.Cells[row][col] = cell
 	return nil
 }
 
-func (b *Board) CheckWin() bool {
-	b.Mux.RLock()
-	defer b.Mux.RUnlock()
-
-	// Check rows and columns
-	for i := range 3 {
-		if b.Cells[i][0].Value != "-" && b.Cells[i][0].Value == b.Cells[i][1].Value && b.Cells[i][1].Value == b.Cells[i][2].Value {
-			b.Cells[i][0].WinState = true
-			b.Cells[i][1].WinState = true
-			b.Cells[i][2].WinState = true
-			return true
-		}
-		if b.Cells[0][i].Value != "-" && b.Cells[0][i].Value == b.Cells[1][i].Value && b.Cells[1][i].Value == b.Cells[2][i].Value {
-			b.Cells[0][i].WinState = true
-			b.Cells[1][i].WinState = true
-			b.Cells[2][i].WinState = true
-			return true
-		}
+// ValidateConfig checks a board and rule set together: each against the
+// product limits, and the engine config they make against the rules.
+func ValidateConfig(config BoardConfig, rules RuleSet) error {
+	if err := config.Validate(); err != nil {
+		return err
 	}
-
-	// Check diagonals
-	if b.Cells[0][0].Value != "-" && b.Cells[0][0].Value == b.Cells[1][1].Value && b.Cells[1][1].Value == b.Cells[2][2].Value {
-		b.Cells[0][0].WinState = true
-		b.Cells[1][1].WinState = true
-		b.Cells[2][2].WinState = true
-		return true
+	if err := rules.Validate(); err != nil {
+		return err
 	}
-	if b.Cells[0][2].Value != "-" && b.Cells[0][2].Value == b.Cells[1][1].Value && b.Cells[1][1].Value == b.Cells[2][0].Value {
-		b.Cells[0][2].WinState = true
-		b.Cells[1][1].WinState = true
-		b.Cells[2][0].WinState = true
-		return true
+	return EngineConfig(config, rules).Validate()
+}
+
+// EngineConfig combines the board and the rule set into the config the rules
+// engine plays by.
+func EngineConfig(config BoardConfig, rules RuleSet) engine.Config {
+	return engine.Config{
+		Rows:         config.Rows,
+		Cols:         config.Cols,
+		WinLength:    config.WinLength,
+		InitialLives: rules.InitialLives,
+		Decay:        rules.Decay,
+		MaxMoves:     rules.MaxMoves,
 	}
+}
 
-	return false
+// Board holds the live engine state of a game. The state itself is
+// immutable; the board only guards which state is current.
+type Board struct {
+	State  engine.State
+	Config BoardConfig
+	Mux    *sync.RWMutex
 }
 
-func (b *Board) CheckDraw() bool {
+func NewBoard(config BoardConfig, rules RuleSet) *Board {
+	return &Board{
+		State:  engine.NewState(EngineConfig(config, rules)),
+		Config: config,
+		Mux:    &sync.RWMutex{},
+	}
+}
+
+func (b *Board) GetState() engine.State {
 	b.Mux.RLock()
 	defer b.Mux.RUnlock()
-
-	for i := range 3 {
-		for j := range 3 {
-			if b.Cells[i][j].Value == "-" {
-				return false
-			}
-		}
-	}
-	return true
+	return b.State
 }
 
-func (b *Board) UpdateLives() {
+func (b *Board) SetState(state engine.State) {
 	b.Mux.Lock()
 	defer b.Mux.Unlock()
+	b.State = state
+}
 
-	for i := range 3 {
-		for j := range 3 {
-			if b.Cells[i][j].Value == "-" {
-				continue
-			}
-			if b.Cells[i][j].Lives == 0 {
-				b.Cells[i][j].Value = "-"
-				b.Cells[i][j].WinState = false
-				b.Cells[i][j].Lives = INITIAL_LIVES
-				continue
-			}
-			b.Cells[i][j].Lives--
-		}
-	}
+// Cells returns a copy of the current board as rows of cells.
+func (b *Board) Cells() [][]engine.Cell {
+	return b.GetState().Cells()
 }
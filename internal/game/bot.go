@@ -0,0 +1,126 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+	"github.com/Monkhai/strixos-server.git/pkg/utils"
+)
+
+type BotDifficulty string
+
+const (
+	BOT_EASY   BotDifficulty = "easy"
+	BOT_MEDIUM BotDifficulty = "medium"
+	BOT_HARD   BotDifficulty = "hard"
+)
+
+const BOT_MOVE_DELAY = 600 * time.Millisecond
+
+func ParseBotDifficulty(difficulty string) (BotDifficulty, error) {
+	switch BotDifficulty(difficulty) {
+	case "":
+		return BOT_MEDIUM, nil
+	case BOT_EASY, BOT_MEDIUM, BOT_HARD:
+		return BotDifficulty(difficulty), nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownBotDifficulty, difficulty)
+	}
+}
+
+// Bot drives a server side Player. Messages written to the bot player land in
+// Inbox instead of a websocket, and the bot answers with moves on the
+// player's GameMessageChan, so the game loops treat it like any other player.
+type Bot struct {
+	Difficulty BotDifficulty
+	Inbox      chan interface{}
+}
+
+func NewBotPlayer(difficulty BotDifficulty, ctx context.Context) *Player {
+	i := identity.NewIdentity(utils.GenerateUniqueID(), "")
+	i.DisplayName = fmt.Sprintf("Strixos Bot (%s)", difficulty)
+	i.IsBot = true
+	p := NewPlayer(i, nil, ctx)
+	p.Bot = &Bot{
+		Difficulty: difficulty,
+		Inbox:      make(chan interface{}, 10),
+	}
+	return p
+}
+
+func (p *Player) IsBot() bool {
+	return p.Bot != nil
+}
+
+// Notify hands a server message to the bot. It never blocks the game loop;
+// if the bot is somehow behind, the message is dropped.
+func (b *Bot) Notify(message interface{}) {
+	select {
+	case b.Inbox <- message:
+	default:
+		log.Println("Bot inbox full, dropping message")
+	}
+}
+
+func (b *Bot) Play(g *Game, p *Player, wg *sync.WaitGroup) {
+	defer func() {
+		wg.Done()
+		p.Cancel()
+	}()
+
+	for {
+		select {
+		case <-g.Ctx.Done():
+			{
+				return
+			}
+		case msg := <-b.Inbox:
+			{
+				var m shared.GenericMessage
+				switch typed := msg.(type) {
+				case shared.GenericMessage:
+					m = typed
+				case *shared.GenericMessage:
+					m = *typed
+				default:
+					continue
+				}
+
+				switch m.Type {
+				case shared.StartGameMessageType, shared.UpdateGameMessageType:
+					{
+						active, ok := m.Content["activePlayer"].(*identity.SafeIdentity)
+						if !ok || active.ID != p.GetID() {
+							continue
+						}
+						select {
+						case <-g.Ctx.Done():
+							return
+						case <-time.After(BOT_MOVE_DELAY):
+						}
+
+						move, ok := ChooseBotMove(g.Board.GetState(), b.Difficulty)
+						if !ok {
+							continue
+						}
+						var moveMsg shared.MoveMessage
+						moveMsg.Type = shared.MoveMessageType
+						moveMsg.Identity = p.GetIdentity()
+						moveMsg.Content.Row = move.Row
+						moveMsg.Content.Col = move.Col
+						p.GameMessageChan <- moveMsg
+					}
+				case shared.GameOverMessageType, shared.GameClosedMessageType:
+					{
+						return
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package game
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
+)
+
+const (
+	BOT_WIN_SCORE    = 1_000_000
+	BOT_MEDIUM_DEPTH = 3
+	// the hard bot does not solve the game: it deepens its search until
+	// BOT_HARD_THINK_TIME is up or BOT_HARD_MAX_DEPTH is reached, whichever
+	// comes first, and plays the best move of the last depth it finished
+	BOT_HARD_MAX_DEPTH  = 16
+	BOT_HARD_THINK_TIME = 1500 * time.Millisecond
+)
+
+type boundFlag int
+
+const (
+	boundExact boundFlag = iota
+	boundLower
+	boundUpper
+)
+
+type tableEntry struct {
+	depth int
+	score int
+	flag  boundFlag
+}
+
+// botSearch runs a depth limited negamax over engine states, so the bot plays
+// by exactly the same place, decay and game-over rules as the live game.
+type botSearch struct {
+	deadline time.Time
+	aborted  bool
+	table    map[string]tableEntry
+}
+
+// terminalScore scores a finished game from the point of view of the player
+// who just moved. Only the mover can complete a line, so any result that is
+// not a draw is a win for them.
+func terminalScore(result engine.Result, depth int) int {
+	if result.IsDraw() {
+		return 0
+	}
+	// prefer quicker wins
+	return BOT_WIN_SCORE + depth
+}
+
+// orderMoves tries the cells closest to the center first, which lets
+// alpha-beta cut more of the tree.
+func orderMoves(state engine.State, moves []engine.Move) []engine.Move {
+	config := state.Config()
+	centerRow, centerCol := float64(config.Rows-1)/2, float64(config.Cols-1)/2
+	slices.SortStableFunc(moves, func(a, b engine.Move) int {
+		distA := math.Abs(float64(a.Row)-centerRow) + math.Abs(float64(a.Col)-centerCol)
+		distB := math.Abs(float64(b.Row)-centerRow) + math.Abs(float64(b.Col)-centerCol)
+		switch {
+		case distA < distB:
+			return -1
+		case distA > distB:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return moves
+}
+
+// scoreMove plays move on state and scores it for the player making it.
+func (s *botSearch) scoreMove(state engine.State, move engine.Move, depth, alpha, beta int) int {
+	child, _, err := engine.Apply(state, move)
+	if err != nil {
+		return -BOT_WIN_SCORE * 2
+	}
+	if result, over := child.Result(); over {
+		return terminalScore(result, depth)
+	}
+	return -s.negamax(child, depth-1, -beta, -alpha)
+}
+
+func (s *botSearch) negamax(state engine.State, depth, alpha, beta int) int {
+	if !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.aborted = true
+		return 0
+	}
+
+	moves := state.LegalMoves()
+	if len(moves) == 0 {
+		return 0
+	}
+	if depth == 0 {
+		return evaluateState(state, state.ToMove())
+	}
+
+	key := state.Key()
+	if entry, ok := s.table[key]; ok && entry.depth >= depth {
+		switch {
+		case entry.flag == boundExact:
+			return entry.score
+		case entry.flag == boundLower && entry.score >= beta:
+			return entry.score
+		case entry.flag == boundUpper && entry.score <= alpha:
+			return entry.score
+		}
+	}
+
+	originalAlpha := alpha
+	best := -BOT_WIN_SCORE * 2
+	for _, move := range orderMoves(state, moves) {
+		score := s.scoreMove(state, move, depth, alpha, beta)
+		if s.aborted {
+			return 0
+		}
+
+		best = max(best, score)
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			break
+		}
+	}
+
+	// a draw is not stored: the key leaves out the positions that led here,
+	// and a repetition draw found along one path may not be one along
+	// another. Scores that only lean on a draw deeper down are still stored,
+	// which can at worst make the bot misjudge a position, never play an
+	// illegal move.
+	if best == 0 {
+		return best
+	}
+	flag := boundExact
+	if best <= originalAlpha {
+		flag = boundUpper
+	} else if best >= beta {
+		flag = boundLower
+	}
+	s.table[key] = tableEntry{depth: depth, score: best, flag: flag}
+	return best
+}
+
+// bestMove searches every move at the root and returns the best one with its
+// score from the point of view of the side to move.
+func (s *botSearch) bestMove(state engine.State, depth int) (engine.Move, int) {
+	moves := orderMoves(state, state.LegalMoves())
+	bestMove, bestScore := moves[0], -BOT_WIN_SCORE*2
+	for _, move := range moves {
+		score := s.scoreMove(state, move, depth, bestScore, BOT_WIN_SCORE*2)
+		if s.aborted {
+			break
+		}
+		if score > bestScore {
+			bestMove, bestScore = move, score
+		}
+	}
+	return bestMove, bestScore
+}
+
+// deepen runs iterative deepening until thinkTime is up or the depth cap is
+// reached, keeping the result of the last depth that finished. It stops early
+// only when it finds a forced win or loss. The state must have a legal move.
+func (s *botSearch) deepen(state engine.State, thinkTime time.Duration) (engine.Move, int) {
+	s.deadline = time.Now().Add(thinkTime)
+	move, score := s.bestMove(state, 1)
+	for depth := 2; depth <= BOT_HARD_MAX_DEPTH; depth++ {
+		candidate, candidateScore := s.bestMove(state, depth)
+		if s.aborted {
+			break
+		}
+		move, score = candidate, candidateScore
+		if score >= BOT_WIN_SCORE || score <= -BOT_WIN_SCORE {
+			break
+		}
+	}
+	return move, score
+}
+
+// evaluateState scores a position for mark by counting the pieces each side
+// has in lines that the opponent has not blocked. Pieces that are about to
+// vanish do not count.
+func evaluateState(state engine.State, mark string) int {
+	score := 0
+	state.Lines(func(cells []engine.Cell) {
+		own, opponent := 0, 0
+		for _, cell := range cells {
+			if cell.Value == engine.EMPTY || cell.Lives == 0 {
+				continue
+			}
+			if cell.Value == mark {
+				own++
+			} else {
+				opponent++
+			}
+		}
+		if opponent == 0 && own > 0 {
+			score += 1 << (2 * own)
+		}
+		if own == 0 && opponent > 0 {
+			score -= 1 << (2 * opponent)
+		}
+	})
+	return score
+}
+
+// ChooseBotMove picks the next move for the side to move in state at the
+// given difficulty.
+func ChooseBotMove(state engine.State, difficulty BotDifficulty) (engine.Move, bool) {
+	moves := state.LegalMoves()
+	if len(moves) == 0 {
+		return engine.Move{}, false
+	}
+
+	search := &botSearch{table: make(map[string]tableEntry)}
+	switch difficulty {
+	case BOT_EASY:
+		{
+			// greedy: take a win when it is on the board, otherwise play anywhere
+			for _, move := range moves {
+				child, _, err := engine.Apply(state, move)
+				if err != nil {
+					continue
+				}
+				if result, over := child.Result(); over && !result.IsDraw() {
+					return move, true
+				}
+			}
+			return moves[rand.IntN(len(moves))], true
+		}
+	case BOT_MEDIUM:
+		{
+			move, _ := search.bestMove(state, BOT_MEDIUM_DEPTH)
+			return move, true
+		}
+	default:
+		{
+			// time limited, see BOT_HARD_THINK_TIME
+			move, _ := search.deepen(state, BOT_HARD_THINK_TIME)
+			return move, true
+		}
+	}
+}
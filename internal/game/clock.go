@@ -0,0 +1,166 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MAX_BASE_TIME_MS = 60 * 60 * 1000
+	MIN_TURN_TIME_MS = 1000
+)
+
+// TimeControl is either a chess-style clock (a base time plus an increment
+// per move), or, when PerTurnMs is set, a fixed limit for every turn, or no
+// clock at all when Untimed is set.
+type TimeControl struct {
+	BaseMs      int64 `json:"baseMs"`
+	IncrementMs int64 `json:"incrementMs"`
+	PerTurnMs   int64 `json:"perTurnMs"`
+	Untimed     bool  `json:"untimed,omitempty"`
+}
+
+var DefaultTimeControl = TimeControl{BaseMs: 3 * 60 * 1000, IncrementMs: 2000}
+
+var UntimedControl = TimeControl{Untimed: true}
+
+func (t TimeControl) IsZero() bool {
+	return t == TimeControl{}
+}
+
+func (t TimeControl) IsTimed() bool {
+	return !t.Untimed
+}
+
+// ParseTimeControl reads a time control written as "untimed", as
+// "<minutes>+<seconds>" for a base time and an increment (so "3+2" is the
+// default) or as "<seconds>/turn" for a fixed limit per turn.
+func ParseTimeControl(value string) (TimeControl, error) {
+	if value == "untimed" {
+		return UntimedControl, nil
+	}
+	if perTurn, ok := strings.CutSuffix(value, "/turn"); ok {
+		seconds, err := strconv.ParseInt(perTurn, 10, 64)
+		if err != nil {
+			return TimeControl{}, fmt.Errorf("%w: per turn time %q is not a number of seconds", ErrInvalidRuleSet, perTurn)
+		}
+		control := TimeControl{PerTurnMs: seconds * 1000}
+		return control, control.Validate()
+	}
+	base, increment, ok := strings.Cut(value, "+")
+	if !ok {
+		return TimeControl{}, fmt.Errorf("%w: time control %q is not untimed, <minutes>+<seconds> or <seconds>/turn", ErrInvalidRuleSet, value)
+	}
+	minutes, err := strconv.ParseInt(base, 10, 64)
+	if err != nil {
+		return TimeControl{}, fmt.Errorf("%w: base time %q is not a number of minutes", ErrInvalidRuleSet, base)
+	}
+	seconds, err := strconv.ParseInt(increment, 10, 64)
+	if err != nil {
+		return TimeControl{}, fmt.Errorf("%w: increment %q is not a number of seconds", ErrInvalidRuleSet, increment)
+	}
+	control := TimeControl{BaseMs: minutes * 60 * 1000, IncrementMs: seconds * 1000}
+	return control, control.Validate()
+}
+
+func (t TimeControl) Validate() error {
+	if t.Untimed {
+		if t.BaseMs != 0 || t.IncrementMs != 0 || t.PerTurnMs != 0 {
+			return fmt.Errorf("%w: an untimed game cannot set clock times", ErrInvalidRuleSet)
+		}
+		return nil
+	}
+	if t.PerTurnMs != 0 {
+		if t.PerTurnMs < MIN_TURN_TIME_MS || t.PerTurnMs > MAX_BASE_TIME_MS {
+			return fmt.Errorf("%w: per turn time must be between %dms and %dms", ErrInvalidRuleSet, MIN_TURN_TIME_MS, MAX_BASE_TIME_MS)
+		}
+		return nil
+	}
+	if t.BaseMs < MIN_TURN_TIME_MS || t.BaseMs > MAX_BASE_TIME_MS {
+		return fmt.Errorf("%w: base time must be between %dms and %dms", ErrInvalidRuleSet, MIN_TURN_TIME_MS, MAX_BASE_TIME_MS)
+	}
+	if t.IncrementMs < 0 || t.IncrementMs > t.BaseMs {
+		return fmt.Errorf("%w: increment must be between 0ms and the base time", ErrInvalidRuleSet)
+	}
+	return nil
+}
+
+// Clock tracks the remaining time of both players in a game. Only the player
+// whose turn it is has a running clock. An untimed clock keeps no time and
+// never runs out.
+type Clock struct {
+	Control   TimeControl
+	Remaining map[string]time.Duration
+	ActiveID  string
+	TurnStart time.Time
+	Mux       *sync.RWMutex
+}
+
+func NewClock(control TimeControl, players [2]*Player) *Clock {
+	initial := time.Duration(control.BaseMs) * time.Millisecond
+	if control.PerTurnMs != 0 {
+		initial = time.Duration(control.PerTurnMs) * time.Millisecond
+	}
+
+	remaining := make(map[string]time.Duration, 2)
+	for _, p := range players {
+		remaining[p.GetID()] = initial
+	}
+	return &Clock{
+		Control:   control,
+		Remaining: remaining,
+		Mux:       &sync.RWMutex{},
+	}
+}
+
+func (c *Clock) StartTurn(p *Player) {
+	c.Mux.Lock()
+	defer c.Mux.Unlock()
+	c.ActiveID = p.GetID()
+	c.TurnStart = time.Now()
+	if c.Control.PerTurnMs != 0 {
+		c.Remaining[p.GetID()] = time.Duration(c.Control.PerTurnMs) * time.Millisecond
+	}
+}
+
+// EndTurn stops p's clock and credits the increment. A move that arrives just
+// after the flag fell is still accepted, so the remaining time is clamped.
+func (c *Clock) EndTurn(p *Player) {
+	c.Mux.Lock()
+	defer c.Mux.Unlock()
+	remaining := max(c.Remaining[p.GetID()]-time.Since(c.TurnStart), 0)
+	c.Remaining[p.GetID()] = remaining + time.Duration(c.Control.IncrementMs)*time.Millisecond
+	c.ActiveID = ""
+}
+
+func (c *Clock) TimeLeft(p *Player) time.Duration {
+	c.Mux.RLock()
+	defer c.Mux.RUnlock()
+	return c.timeLeft(p.GetID())
+}
+
+func (c *Clock) timeLeft(id string) time.Duration {
+	remaining := c.Remaining[id]
+	if id == c.ActiveID {
+		remaining -= time.Since(c.TurnStart)
+	}
+	return max(remaining, 0)
+}
+
+// Snapshot returns the remaining milliseconds of every player keyed by their
+// id, or nil for an untimed game.
+func (c *Clock) Snapshot() map[string]int64 {
+	c.Mux.RLock()
+	defer c.Mux.RUnlock()
+	if !c.Control.IsTimed() {
+		return nil
+	}
+	snapshot := make(map[string]int64, len(c.Remaining))
+	for id := range c.Remaining {
+		snapshot[id] = c.timeLeft(id).Milliseconds()
+	}
+	return snapshot
+}
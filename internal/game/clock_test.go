@@ -0,0 +1,51 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	tests := []struct {
+		value string
+		want  TimeControl
+	}{
+		{"untimed", UntimedControl},
+		{"3+2", DefaultTimeControl},
+		{"10+0", TimeControl{BaseMs: 10 * 60 * 1000}},
+		{"30/turn", TimeControl{PerTurnMs: 30 * 1000}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeControl(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTimeControl(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "fast", "3", "x+2", "3+y", "0+0", "3+500", "0/turn", "soon/turn"} {
+		if _, err := ParseTimeControl(value); !errors.Is(err, ErrInvalidRuleSet) {
+			t.Errorf("ParseTimeControl(%q) = %v, want %v", value, err, ErrInvalidRuleSet)
+		}
+	}
+}
+
+func TestUntimedControl(t *testing.T) {
+	if err := UntimedControl.Validate(); err != nil {
+		t.Fatalf("UntimedControl.Validate() = %v, want it to be valid", err)
+	}
+	mixed := TimeControl{Untimed: true, BaseMs: 60 * 1000}
+	if err := mixed.Validate(); !errors.Is(err, ErrInvalidRuleSet) {
+		t.Errorf("Validate() of an untimed control with a base time = %v, want %v", err, ErrInvalidRuleSet)
+	}
+
+	rules, err := NewRuleSet(0, "", 0, UntimedControl)
+	if err != nil || rules.TimeControl.IsTimed() {
+		t.Fatalf("NewRuleSet with UntimedControl = %+v, %v, want untimed rules", rules, err)
+	}
+
+	clock := NewClock(UntimedControl, [2]*Player{NewBotPlayer(BOT_EASY, context.Background()), NewBotPlayer(BOT_EASY, context.Background())})
+	if snapshot := clock.Snapshot(); snapshot != nil {
+		t.Errorf("Snapshot() = %v, want nil for an untimed clock", snapshot)
+	}
+}
@@ -2,166 +2,379 @@ package game
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/Monkhai/strixos-server.git/internal/engine"
 	"github.com/Monkhai/strixos-server.git/pkg/shared"
 	"github.com/Monkhai/strixos-server.git/pkg/utils"
 )
 
+const (
+	MARK_X = engine.MARK_X
+	MARK_O = engine.MARK_O
+)
+
+// GameLoopOverMessage is sent by Run when the game reaches a result, so the
+// server can route the players through the game's mode.
+type GameLoopOverMessage struct {
+	GameID  string
+	Result  GameResult
+	Players [2]*Player
+}
+
 type Game struct {
-	ID      string
-	Board   *Board
-	Player1 *Player
-	Player2 *Player
-	MsgChan chan interface{}
-	Ctx     context.Context
-	Cancel  context.CancelFunc
-	Mux     *sync.RWMutex
+	ID     string
+	Board  *Board
+	Rules  RuleSet
+	Clock  *Clock
+	Series *Series
+	Mode   GameMode
+	// ActivePlayer is the player whose turn it is, nil until the loop starts.
+	ActivePlayer *Player
+	Spectators   map[string]*Player
+	History      []MoveRecord
+	HintsUsed    map[string]int
+	StartedAt    time.Time
+	Player1      *Player
+	Player2      *Player
+	MsgChan      chan interface{}
+	Ctx          context.Context
+	Cancel       context.CancelFunc
+	Mux          *sync.RWMutex
+	// ReconnectGrace is how long a dropped player has to come back before
+	// they lose the game. Zero ends the game as soon as they drop.
+	ReconnectGrace time.Duration
+	ReconnectChan  chan ReconnectedMessage
+	// Rater rates the game when it ends. Nil means the game is unrated.
+	Rater        Rater
+	RatingOptIns map[string]bool
+	// hint searches running for this game post their result on hintChan;
+	// hintedAt is the move count of each player's last hint
+	hintChan chan hintResult
+	hintedAt map[string]int
 }
 
-func NewGame(players [2]*Player, parentCtx context.Context) *Game {
+func NewGame(players [2]*Player, config BoardConfig, rules RuleSet, parentCtx context.Context) (*Game, error) {
+	if err := ValidateConfig(config, rules); err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithCancel(parentCtx)
 	players[0].SetIsInGame(true)
 	players[1].SetIsInGame(true)
 	return &Game{
-		Mux:     &sync.RWMutex{},
-		Board:   NewBoard(),
-		Player1: players[0],
-		Player2: players[1],
-		MsgChan: make(chan interface{}, 10),
-		Ctx:     ctx,
-		Cancel:  cancel,
-		ID:      utils.GenerateUniqueID(),
+		Mux:           &sync.RWMutex{},
+		Board:         NewBoard(config, rules),
+		Rules:         rules,
+		Mode:          BaseMode{},
+		Spectators:    make(map[string]*Player),
+		HintsUsed:     make(map[string]int),
+		Player1:       players[0],
+		Player2:       players[1],
+		MsgChan:       make(chan interface{}, 10),
+		ReconnectChan: make(chan ReconnectedMessage),
+		Ctx:           ctx,
+		Cancel:        cancel,
+		ID:            utils.GenerateUniqueID(),
+	}, nil
+}
+
+// GetMark returns the mark the server assigned to p. Player1 always plays x.
+func (g *Game) GetMark(p *Player) string {
+	if p.GetID() == g.Player1.GetID() {
+		return MARK_X
+	}
+	return MARK_O
+}
+
+// ResolveMark returns the mark to place for p's move. Clients may omit the
+// mark, but any mark they do send must match the one assigned to them.
+func (g *Game) ResolveMark(p *Player, clientMark string) (string, error) {
+	mark := g.GetMark(p)
+	if clientMark != "" && clientMark != mark {
+		return "", ErrMarkNotOwned
+	}
+	return mark, nil
+}
+
+func (g *Game) SetActivePlayer(p *Player) {
+	g.Mux.Lock()
+	defer g.Mux.Unlock()
+	g.ActivePlayer = p
+}
+
+func (g *Game) GetActivePlayer() *Player {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+	return g.ActivePlayer
+}
+
+// PlayMove validates p's move and runs it through the rules engine. It
+// reports the result if the move ended the game.
+func (g *Game) PlayMove(p *Player, row, col int, clientMark string) (GameResult, bool, error) {
+	mark, err := g.ResolveMark(p, clientMark)
+	if err != nil {
+		return GameResult{}, false, err
+	}
+	if err := g.Mode.ValidateMove(g, p, row, col); err != nil {
+		return GameResult{}, false, err
+	}
+
+	state := g.Board.GetState()
+	if state.ToMove() != mark {
+		return GameResult{}, false, ErrNotYourTurn
+	}
+	next, events, err := engine.Apply(state, engine.Move{Row: row, Col: col})
+	if err != nil {
+		return GameResult{}, false, err
+	}
+	g.Board.SetState(next)
+	g.RecordMove(p, next, row, col, events)
+
+	result, over := next.Result()
+	if !over {
+		return GameResult{}, false, nil
+	}
+	return g.resultFromEngine(result), true, nil
+}
+
+func moveErrorCode(err error) shared.ErrorCode {
+	if errors.Is(err, ErrMarkNotOwned) {
+		return shared.InvalidMarkErrorCode
 	}
+	return shared.InvalidMoveErrorCode
+}
+
+// endGame hands the result to the mode and reports it to the server.
+func (g *Game) endGame(result GameResult) {
+	log.Printf("Game %s over: %s\n", g.ID, result.Reason)
+	result = g.RateResult(result)
+	g.Mode.OnGameOver(g, result)
+	g.report(GameLoopOverMessage{GameID: g.ID, Result: result, Players: [2]*Player{g.Player1, g.Player2}})
+}
+
+// releasePlayers marks both players as out of this game.
+func (g *Game) releasePlayers() {
+	g.Player1.SetIsInGame(false)
+	g.Player2.SetIsInGame(false)
 }
 
-func (g *Game) GameLoop(wg *sync.WaitGroup) {
+// report hands the final message of the game to the server. The players are
+// released first: the server may put them straight into their next game,
+// such as the next one of a series, and this game winding down must not mark
+// them as out of it.
+func (g *Game) report(msg interface{}) {
+	g.releasePlayers()
+	g.MsgChan <- msg
+}
+
+func (g *Game) Run(wg *sync.WaitGroup) {
 	defer func() {
 		wg.Done()
 		g.Cancel()
-		g.Player1.SetIsInGame(false)
-		g.Player2.SetIsInGame(false)
 	}()
 
+	// a restored game picks up with whoever was to move
 	currentPlayer := g.Player1
 	otherPlayer := g.Player2
+	if g.GetMark(currentPlayer) != g.Board.GetState().ToMove() {
+		currentPlayer, otherPlayer = otherPlayer, currentPlayer
+	}
+
+	log.Printf("\n%s game started between %s and %s\n\n", g.Mode.Name(), g.Player1.GetID(), g.Player2.GetID())
+
+	if g.Clock == nil {
+		g.Clock = NewClock(g.Rules.TimeControl, [2]*Player{g.Player1, g.Player2})
+	}
+	g.Clock.StartTurn(currentPlayer)
+	if g.StartedAt.IsZero() {
+		g.StartedAt = time.Now()
+	}
+	g.SetActivePlayer(currentPlayer)
+	// an untimed game has no turn timer; a nil channel never fires
+	var turnTimer *time.Timer
+	var turnTimeout <-chan time.Time
+	if g.Clock.Control.IsTimed() {
+		turnTimer = time.NewTimer(g.Clock.TimeLeft(currentPlayer))
+		defer turnTimer.Stop()
+		turnTimeout = turnTimer.C
+	}
 
-	log.Printf("\nGame started between %s and %s\n\n", g.Player1.Identity.ID, g.Player2.Identity.ID)
+	g.hintChan = make(chan hintResult)
+	g.hintedAt = make(map[string]int)
+	g.Mode.OnStart(g)
 
-	// start game for the Players and tell them who they are and who is the next player
-	currentPlayerStartGameMsg := g.NewGameMessage("x", currentPlayer, otherPlayer)
-	currentPlayer.WriteMessage(currentPlayerStartGameMsg)
-	otherPlayerStartGameMsg := g.NewGameMessage("o", currentPlayer, currentPlayer)
-	otherPlayer.WriteMessage(otherPlayerStartGameMsg)
+	// players who dropped and are inside their reconnect grace period, with
+	// the timer of that period and how many times they have dropped
+	away := make(map[string]bool)
+	graceTimers := make(map[string]*time.Timer)
+	drops := make(map[string]int)
+	graceExpired := make(chan graceExpiry, 2)
+	defer func() {
+		for _, timer := range graceTimers {
+			timer.Stop()
+		}
+	}()
+	messagesFrom := func(p *Player) chan interface{} {
+		if away[p.GetID()] {
+			// the old connection's channels are closed, wait for the new one
+			return nil
+		}
+		return p.GameMessageChan
+	}
+	// disconnected reports whether p dropping out ends the game.
+	disconnected := func(p, opponent *Player) bool {
+		if g.ReconnectGrace <= 0 || away[opponent.GetID()] {
+			log.Printf("Player %s disconnected. Ending game.\n", p.GetID())
+			opponent.WriteMessage(shared.OpponentDisconnectedMessage)
+			g.report(DisconnectedMessage{Player: p})
+			return true
+		}
+		away[p.GetID()] = true
+		drops[p.GetID()]++
+		graceTimers[p.GetID()] = g.waitForReconnect(p, drops[p.GetID()], graceExpired)
+		return false
+	}
 
 	for {
 		select {
 		case <-g.Ctx.Done():
 			{
-				log.Printf("Game between %s and %s ended\n", g.Player1.Identity.ID, g.Player2.Identity.ID)
+				log.Printf("Game between %s and %s ended\n", g.Player1.GetID(), g.Player2.GetID())
+				g.releasePlayers()
 				return
 			}
 
-		case msg := <-currentPlayer.GameMessageChan:
+		case <-turnTimeout:
 			{
+				log.Printf("Player %s ran out of time. Ending game.\n", currentPlayer.GetID())
+				g.endGame(GameResult{Winner: otherPlayer, Reason: REASON_TIMEOUT})
+				return
+			}
+
+		case expiry := <-graceExpired:
+			{
+				p := expiry.Player
+				if !away[p.GetID()] || expiry.Drop != drops[p.GetID()] {
+					continue
+				}
+				log.Printf("Player %s did not reconnect in time. Ending game.\n", p.GetID())
+				g.Opponent(p).WriteMessage(shared.OpponentDisconnectedMessage)
+				g.report(DisconnectedMessage{Player: p})
+				return
+			}
+
+		case result := <-g.hintChan:
+			{
+				g.deliverHint(result, currentPlayer)
+			}
+
+		case m := <-g.ReconnectChan:
+			{
+				old := g.replacePlayer(m.Player)
+				if !away[old.GetID()] {
+					// the old socket has not noticed it is dead yet
+					old.Cancel()
+					old.Conn.Close()
+				}
+				delete(away, old.GetID())
+				if timer, ok := graceTimers[old.GetID()]; ok {
+					timer.Stop()
+					delete(graceTimers, old.GetID())
+				}
+				if currentPlayer == old {
+					currentPlayer = m.Player
+				} else {
+					otherPlayer = m.Player
+				}
+				log.Printf("Player %s reconnected to game %s\n", m.Player.GetID(), g.ID)
+				m.Player.SetIsInGame(true)
+				m.Player.WriteMessage(g.ResyncMessage(m.Player))
+				g.Opponent(m.Player).WriteMessage(shared.OpponentReconnectedMessage)
+			}
+
+		case msg, ok := <-messagesFrom(currentPlayer):
+			{
+				if !ok {
+					// the connection closed without a goodbye reaching the game
+					msg = DisconnectedMessage{Player: currentPlayer}
+				}
 				switch m := msg.(type) {
 				case DisconnectedMessage:
 					{
-						log.Printf("Player %s disconnected. Ending game.\n", currentPlayer.Identity.ID)
-						otherPlayer.Conn.WriteJSON(m)
-						g.MsgChan <- DisconnectedMessage{Player: currentPlayer}
-						return
+						if disconnected(currentPlayer, otherPlayer) {
+							return
+						}
 					}
 
 				case shared.MoveMessage:
 					{
 						log.Println("Move message", "Row:", m.Content.Row, "Col:", m.Content.Col)
-						err := g.Board.SetCell(m.Content.Row, m.Content.Col, m.Content.Mark)
+						result, over, err := g.PlayMove(currentPlayer, m.Content.Row, m.Content.Col, m.Content.Mark)
 						if err != nil {
-							log.Println("Error getting cell", err)
-							currentPlayer.WriteMessage(shared.GenericMessage{
-								Type: shared.ErrorMessageType,
-								Content: map[string]any{
-									"message": err.Error(),
-								},
-							})
+							log.Printf("Player %s sent an invalid move: %s\n", currentPlayer.GetID(), err)
+							currentPlayer.WriteMessage(shared.TypedErrorMessage(moveErrorCode(err), err.Error()))
 							continue
 						}
-
-						g.Board.UpdateLives()
-						if g.Board.CheckWin() {
-							currentPlayer.WriteMessage(*GameOverMessage(g.Board, currentPlayer))
-							otherPlayer.WriteMessage(*GameOverMessage(g.Board, currentPlayer))
-							log.Printf("Game over. Player %s won.\n", currentPlayer.Identity.ID)
+						if over {
+							g.endGame(result)
 							return
 						}
 
+						g.Clock.EndTurn(currentPlayer)
 						currentPlayer, otherPlayer = otherPlayer, currentPlayer
+						g.SetActivePlayer(currentPlayer)
+						g.Clock.StartTurn(currentPlayer)
+						if turnTimer != nil {
+							turnTimer.Reset(g.Clock.TimeLeft(currentPlayer))
+						}
 						updateMsg := g.GameUpdateMessage(currentPlayer)
-						currentPlayer.WriteMessage(updateMsg)
-						otherPlayer.WriteMessage(updateMsg)
-						break
+						g.Broadcast(updateMsg)
 					}
 
 				case shared.BaseClientMessage:
 					{
-						switch m.Type {
-						case shared.LeaveGameMessageType:
-							{
-								log.Printf("Player %s left the game. Ending game.\n", currentPlayer.Identity.ID)
-								g.MsgChan <- LeaveGameMessage{RequestingPlayer: currentPlayer, OtherPlayer: otherPlayer}
-								return
-							}
-						case shared.LeaveQueueMessageType:
-							{
-								log.Printf("Player asked to leave game queue inside game. Ignoring. %v\n", m)
-							}
-						default:
-							{
-								log.Printf("Unknown message type: %s\n", m.Type)
-							}
-
+						if g.handleClientMessage(m, currentPlayer, otherPlayer) {
+							return
 						}
 					}
 
 				default:
 					{
-						log.Println("Unkown message received", m)
+						log.Printf("Unkown message received: %T\n", m)
 					}
 				}
 			}
 
-		case msg := <-otherPlayer.GameMessageChan:
-			switch m := msg.(type) {
-			case shared.CloseMessage:
-				{
-					fmt.Printf("Player %s disconnected. Ending game.\n", currentPlayer.Identity.ID)
-					otherPlayer.Conn.WriteJSON(m)
-					g.MsgChan <- DisconnectedMessage{Player: otherPlayer}
-					return
-				}
-			case shared.MoveMessage:
-				{
-					fmt.Printf("Ignoring message from %s (not their turn): %v\n", otherPlayer.Identity.ID, m.Content)
+		case msg, ok := <-messagesFrom(otherPlayer):
+			{
+				if !ok {
+					msg = DisconnectedMessage{Player: otherPlayer}
 				}
-			case shared.BaseClientMessage:
-				{
-					switch m.Type {
-					case shared.LeaveGameMessageType:
-						{
-							log.Printf("Player %s left the game. Ending game.\n", otherPlayer.Identity.ID)
-							g.MsgChan <- LeaveGameMessage{RequestingPlayer: otherPlayer, OtherPlayer: currentPlayer}
+				switch m := msg.(type) {
+				case DisconnectedMessage:
+					{
+						if disconnected(otherPlayer, currentPlayer) {
 							return
 						}
-					case shared.LeaveQueueMessageType:
-						{
-							log.Printf("Player asked to leave game queue inside game. Ignoring. %v\n", m)
-						}
-					default:
-						{
-							log.Printf("Unknown message type: %s\n", m.Type)
+					}
+				case shared.CloseMessage:
+					{
+						log.Printf("Player %s disconnected. Ending game.\n", otherPlayer.GetID())
+						currentPlayer.WriteMessage(shared.OpponentDisconnectedMessage)
+						g.report(DisconnectedMessage{Player: otherPlayer})
+						return
+					}
+				case shared.MoveMessage:
+					{
+						log.Printf("Ignoring message from %s (not their turn): %v\n", otherPlayer.GetID(), m.Content)
+					}
+				case shared.BaseClientMessage:
+					{
+						if g.handleClientMessage(m, otherPlayer, currentPlayer) {
+							return
 						}
 					}
 				}
@@ -169,3 +382,32 @@ func (g *Game) GameLoop(wg *sync.WaitGroup) {
 		}
 	}
 }
+
+// handleClientMessage handles the non-move messages either player can send
+// during a game. It reports whether the game is over.
+func (g *Game) handleClientMessage(m shared.BaseClientMessage, sender, opponent *Player) bool {
+	switch m.Type {
+	case shared.LeaveGameMessageType:
+		{
+			log.Printf("Player %s left the game. Ending game.\n", sender.GetID())
+			g.report(LeaveGameMessage{RequestingPlayer: sender, OtherPlayer: opponent})
+			return true
+		}
+	case shared.LeaveQueueMessageType:
+		{
+			log.Printf("Player %s asked to leave game queue inside game. Ignoring.\n", sender.GetID())
+		}
+	case shared.RequestHintMessageType:
+		{
+			if err := g.RequestHint(sender); err != nil {
+				log.Printf("Refused hint for player %s: %s\n", sender.GetID(), err)
+				sender.WriteMessage(shared.TypedErrorMessage(hintErrorCode(err), err.Error()))
+			}
+		}
+	default:
+		{
+			log.Printf("Unknown message type: %s\n", m.Type)
+		}
+	}
+	return false
+}
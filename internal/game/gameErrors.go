@@ -0,0 +1,16 @@
+package game
+
+import "errors"
+
+var (
+	ErrMarkNotOwned         = errors.New("mark does not belong to player")
+	ErrNotYourTurn          = errors.New("not your turn")
+	ErrInvalidBoardConfig   = errors.New("invalid board config")
+	ErrInvalidRuleSet       = errors.New("invalid rule set")
+	ErrInvalidSeries        = errors.New("invalid series")
+	ErrUnknownBotDifficulty = errors.New("unknown bot difficulty")
+	ErrHintsNotAllowed      = errors.New("hints are not allowed in this game")
+	ErrNoHintAvailable      = errors.New("no move to suggest")
+	ErrHintAlreadyUsed      = errors.New("already had a hint this turn")
+	ErrInvalidSnapshot      = errors.New("invalid game snapshot")
+)
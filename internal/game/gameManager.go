@@ -0,0 +1,45 @@
+package game
+
+import "sync"
+
+type GameManager struct {
+	Map map[string]*Game
+	Mux *sync.RWMutex
+}
+
+func NewGameManager() *GameManager {
+	return &GameManager{
+		Map: make(map[string]*Game),
+		Mux: &sync.RWMutex{},
+	}
+}
+
+func (i *GameManager) AddGame(newGame *Game) {
+	i.Mux.Lock()
+	defer i.Mux.Unlock()
+	i.Map[newGame.ID] = newGame
+}
+
+func (i *GameManager) RemoveGame(gameID string) {
+	i.Mux.Lock()
+	defer i.Mux.Unlock()
+	delete(i.Map, gameID)
+}
+
+// Games returns every game currently managed.
+func (i *GameManager) Games() []*Game {
+	i.Mux.RLock()
+	defer i.Mux.RUnlock()
+	games := make([]*Game, 0, len(i.Map))
+	for _, g := range i.Map {
+		games = append(games, g)
+	}
+	return games
+}
+
+func (i *GameManager) GetGame(gameID string) (*Game, bool) {
+	i.Mux.RLock()
+	defer i.Mux.RUnlock()
+	game, ok := i.Map[gameID]
+	return game, ok
+}
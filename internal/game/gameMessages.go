@@ -5,15 +5,25 @@ import (
 )
 
 func (g *Game) NewGameMessage(mark string, activePlayer, opponent *Player) shared.GenericMessage {
+	content := map[string]any{
+		"board":        g.Board.Cells(),
+		"boardConfig":  g.Board.Config,
+		"rules":        g.Rules,
+		"mark":         mark,
+		"activePlayer": activePlayer.GetSafeIdentity(),
+		"opponent":     opponent.GetSafeIdentity(),
+		"gameID":       g.ID,
+		"clocks":       g.Clock.Snapshot(),
+	}
+	if g.Series != nil {
+		content["series"] = g.Series.content()
+	}
+	if g.Rater != nil {
+		content["ratingStakes"] = g.Rater.Stakes(g)
+	}
 	return shared.GenericMessage{
-		Type: shared.StartGameMessageType,
-		Content: map[string]any{
-			"board":        g.Board.Cells,
-			"mark":         mark,
-			"activePlayer": activePlayer.Identity.GetSafeIdentity(),
-			"opponent":     opponent.Identity.GetSafeIdentity(),
-			"gameID":       g.ID,
-		},
+		Type:    shared.StartGameMessageType,
+		Content: content,
 	}
 }
 
@@ -21,29 +31,44 @@ func (g *Game) GameUpdateMessage(activePlayer *Player) shared.GenericMessage {
 	return shared.GenericMessage{
 		Type: shared.UpdateGameMessageType,
 		Content: map[string]any{
-			"board":        g.Board.Cells,
-			"activePlayer": activePlayer.Identity.GetSafeIdentity(),
+			"board":        g.Board.Cells(),
+			"activePlayer": activePlayer.GetSafeIdentity(),
+			"clocks":       g.Clock.Snapshot(),
+			"spectators":   g.SpectatorCount(),
 		},
 	}
 }
 
-func GameOverMessage(board *Board, winner *Player) *shared.GenericMessage {
+// gameOverContent fills in the fields shared by every game over message. The
+// winner is null when the game ended in a draw.
+func gameOverContent(board *Board, result GameResult) map[string]any {
+	content := map[string]any{
+		"board":  board.Cells(),
+		"winner": nil,
+		"isDraw": result.IsDraw(),
+		"reason": result.Reason,
+	}
+	if result.Winner != nil {
+		content["winner"] = result.Winner.GetSafeIdentity()
+	}
+	if result.RatingChanges != nil {
+		content["ratingChanges"] = result.RatingChanges
+	}
+	return content
+}
+
+func GameOverMessage(board *Board, result GameResult) *shared.GenericMessage {
 	return &shared.GenericMessage{
-		Type: shared.GameOverMessageType,
-		Content: map[string]any{
-			"board":  board.Cells,
-			"winner": winner.Identity.GetSafeIdentity(),
-		},
+		Type:    shared.GameOverMessageType,
+		Content: gameOverContent(board, result),
 	}
 }
 
-func InviteGameOverMessage(board *Board, winner *Player, newGameID string) *shared.GenericMessage {
+func InviteGameOverMessage(board *Board, result GameResult, newGameID string) *shared.GenericMessage {
+	content := gameOverContent(board, result)
+	content["newGameID"] = newGameID
 	return &shared.GenericMessage{
-		Type: shared.InviteGameOverMessageType,
-		Content: map[string]any{
-			"board":     board.Cells,
-			"winner":    winner.Identity.GetSafeIdentity(),
-			"newGameID": newGameID,
-		},
+		Type:    shared.InviteGameOverMessageType,
+		Content: content,
 	}
 }
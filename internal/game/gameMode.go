@@ -0,0 +1,50 @@
+package game
+
+import "log"
+
+// GameMode customises a Game without copying its loop. Run calls OnStart
+// once the clocks are set, ValidateMove before a move reaches the board and
+// OnGameOver when the game reaches a result. AllowsHints decides whether
+// players may ask the server for the best move. RouteGameOver runs on the server
+// side after the loop has reported the result, and decides what the players
+// do next (rematch, next series game, new invite link, ...).
+type GameMode interface {
+	Name() string
+	OnStart(g *Game)
+	ValidateMove(g *Game, p *Player, row, col int) error
+	AllowsHints() bool
+	OnGameOver(g *Game, result GameResult)
+	RouteGameOver(g *Game, result GameResult)
+}
+
+// BaseMode is a plain game with no post-game routing. Modes embed it and
+// override only the hooks they need.
+type BaseMode struct{}
+
+func (BaseMode) Name() string {
+	return "casual"
+}
+
+// OnStart tells both players who they are and who moves first.
+func (BaseMode) OnStart(g *Game) {
+	activePlayer := g.GetActivePlayer()
+	g.Player1.WriteMessage(g.NewGameMessage(g.GetMark(g.Player1), activePlayer, g.Player2))
+	g.Player2.WriteMessage(g.NewGameMessage(g.GetMark(g.Player2), activePlayer, g.Player1))
+}
+
+func (BaseMode) ValidateMove(g *Game, p *Player, row, col int) error {
+	return nil
+}
+
+// AllowsHints is true for casual and bot games. Ranked modes turn it off.
+func (BaseMode) AllowsHints() bool {
+	return true
+}
+
+func (BaseMode) OnGameOver(g *Game, result GameResult) {
+	g.Broadcast(*GameOverMessage(g.Board, result))
+}
+
+func (BaseMode) RouteGameOver(g *Game, result GameResult) {
+	log.Printf("Game %s ended, nothing to route\n", g.ID)
+}
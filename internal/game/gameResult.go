@@ -0,0 +1,39 @@
+package game
+
+import "github.com/Monkhai/strixos-server.git/internal/engine"
+
+type GameOverReason string
+
+const (
+	REASON_WIN          GameOverReason = GameOverReason(engine.REASON_WIN)
+	REASON_FULL_BOARD   GameOverReason = GameOverReason(engine.REASON_FULL_BOARD)
+	REASON_REPETITION   GameOverReason = GameOverReason(engine.REASON_REPETITION)
+	REASON_MOVE_LIMIT   GameOverReason = GameOverReason(engine.REASON_MOVE_LIMIT)
+	REASON_TIMEOUT      GameOverReason = "timeout"
+	REASON_LEFT         GameOverReason = "left"
+	REASON_DISCONNECTED GameOverReason = "disconnected"
+)
+
+// GameResult describes how a game ended. A nil Winner means a draw.
+// RatingChanges is only set for rated games, keyed by player ID.
+type GameResult struct {
+	Winner        *Player
+	Reason        GameOverReason
+	RatingChanges map[string]RatingChange
+}
+
+func (r GameResult) IsDraw() bool {
+	return r.Winner == nil
+}
+
+// resultFromEngine maps the engine's winning mark back to the player.
+func (g *Game) resultFromEngine(result engine.Result) GameResult {
+	gameResult := GameResult{Reason: GameOverReason(result.Reason)}
+	switch result.Winner {
+	case g.GetMark(g.Player1):
+		gameResult.Winner = g.Player1
+	case g.GetMark(g.Player2):
+		gameResult.Winner = g.Player2
+	}
+	return gameResult
+}
@@ -0,0 +1,137 @@
+package game
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+// HINT_THINK_TIME is how long a hint search may take. It is well below the
+// hard bot's, since a player is waiting on it during their own turn.
+const HINT_THINK_TIME = 300 * time.Millisecond
+
+type Evaluation string
+
+const (
+	EVAL_WINNING Evaluation = "winning"
+	EVAL_DRAWN   Evaluation = "drawn"
+	EVAL_LOSING  Evaluation = "losing"
+)
+
+// Hint is the move the hard bot would play for the side to move, and how the
+// search rates the position for them.
+type Hint struct {
+	Move       engine.Move `json:"move"`
+	Evaluation Evaluation  `json:"evaluation"`
+}
+
+func evaluationFromScore(score int) Evaluation {
+	switch {
+	case score >= BOT_WIN_SCORE:
+		return EVAL_WINNING
+	case score <= -BOT_WIN_SCORE:
+		return EVAL_LOSING
+	default:
+		return EVAL_DRAWN
+	}
+}
+
+// SuggestMove searches state for up to HINT_THINK_TIME. A position counts as
+// winning or losing only when the search found a forced result within its
+// horizon, everything else is reported as drawn.
+func SuggestMove(state engine.State) (Hint, bool) {
+	if len(state.LegalMoves()) == 0 {
+		return Hint{}, false
+	}
+	search := &botSearch{table: make(map[string]tableEntry)}
+	move, score := search.deepen(state, HINT_THINK_TIME)
+	return Hint{Move: move, Evaluation: evaluationFromScore(score)}, true
+}
+
+// hintResult carries a finished hint search back to the game loop. MoveCount
+// is the position it was searched for.
+type hintResult struct {
+	PlayerID  string
+	MoveCount int
+	Hint      Hint
+	Found     bool
+}
+
+// RequestHint starts a hint search for p. Hints are only given on the
+// player's own turn, at most once per turn, only in modes that allow them and
+// never in rated games. The search runs off the game loop, so the game keeps
+// handling moves, clocks and reconnects meanwhile; Run hands the result to
+// deliverHint.
+func (g *Game) RequestHint(p *Player) error {
+	if !g.Mode.AllowsHints() || g.Rater != nil {
+		return ErrHintsNotAllowed
+	}
+	if g.GetActivePlayer() != p {
+		return ErrNotYourTurn
+	}
+	state := g.Board.GetState()
+	if len(state.LegalMoves()) == 0 {
+		return ErrNoHintAvailable
+	}
+	if moveCount, ok := g.hintedAt[p.GetID()]; ok && moveCount == state.MoveCount() {
+		return ErrHintAlreadyUsed
+	}
+	g.hintedAt[p.GetID()] = state.MoveCount()
+
+	go func() {
+		hint, found := SuggestMove(state)
+		select {
+		case g.hintChan <- hintResult{PlayerID: p.GetID(), MoveCount: state.MoveCount(), Hint: hint, Found: found}:
+		case <-g.Ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// deliverHint sends a finished search to the player who asked for it and
+// counts it against them. A hint for a position that is gone by now is
+// dropped.
+func (g *Game) deliverHint(result hintResult, active *Player) {
+	if active.GetID() != result.PlayerID || g.Board.GetState().MoveCount() != result.MoveCount {
+		log.Printf("Dropping a stale hint for player %s\n", result.PlayerID)
+		return
+	}
+	if !result.Found {
+		active.WriteMessage(shared.TypedErrorMessage(shared.NoHintAvailableErrorCode, ErrNoHintAvailable.Error()))
+		return
+	}
+
+	g.Mux.Lock()
+	g.HintsUsed[active.GetID()]++
+	g.Mux.Unlock()
+	active.WriteMessage(g.HintMessage(active, result.Hint))
+}
+
+func (g *Game) HintMessage(p *Player, hint Hint) shared.GenericMessage {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+	return shared.GenericMessage{
+		Type: shared.HintMessageType,
+		Content: map[string]any{
+			"move":       hint.Move,
+			"evaluation": hint.Evaluation,
+			"hintsUsed":  g.HintsUsed[p.GetID()],
+		},
+	}
+}
+
+func hintErrorCode(err error) shared.ErrorCode {
+	switch {
+	case errors.Is(err, ErrHintsNotAllowed):
+		return shared.HintsNotAllowedErrorCode
+	case errors.Is(err, ErrNotYourTurn):
+		return shared.NotYourTurnErrorCode
+	case errors.Is(err, ErrHintAlreadyUsed):
+		return shared.HintAlreadyUsedErrorCode
+	default:
+		return shared.NoHintAvailableErrorCode
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"strings"
 	"sync"
@@ -21,8 +22,11 @@ type Player struct {
 	Ctx               context.Context
 	Cancel            context.CancelFunc
 	IsInGame          bool
+	SpectatingGameID  string
 	Mux               *sync.RWMutex
+	WriteMux          *sync.Mutex
 	Identity          *identity.Identity
+	Bot               *Bot
 }
 
 func NewPlayer(identity *identity.Identity, conn *websocket.Conn, ctx context.Context) *Player {
@@ -35,16 +39,19 @@ func NewPlayer(identity *identity.Identity, conn *websocket.Conn, ctx context.Co
 		Cancel:            cancel,
 		IsInGame:          false,
 		Mux:               &sync.RWMutex{},
+		WriteMux:          &sync.Mutex{},
 		Identity:          identity,
 	}
 }
 
-func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Identity) (bool, error)) {
+// Listen reads p's messages and routes them to the server or the game.
+// authenticate checks every message against the connection's identity.
+func (p *Player) Listen(wg *sync.WaitGroup, authenticate func(p *Player, msg shared.BaseClientMessage) error) {
 	defer func() {
 		wg.Done()
 		close(p.GameMessageChan)
 		close(p.ServerMessageChan)
-		log.Printf("Player %s listener done\n", p.Identity.ID)
+		log.Printf("Player %s listener done\n", p.GetID())
 	}()
 
 	messageChan := make(chan []byte)
@@ -65,7 +72,7 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 		select {
 		case <-p.Ctx.Done():
 			{
-				log.Printf("Player %s context done\n", p.Identity.ID)
+				log.Printf("Player %s context done\n", p.GetID())
 				p.WriteMessage(shared.DisconnectedFromServerMessage)
 				return
 			}
@@ -73,20 +80,20 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 			{
 				var baseMsg shared.BaseClientMessage
 				if err := json.Unmarshal(msg, &baseMsg); err != nil {
-					log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+					log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 					continue
 				}
-				log.Println(p.Identity.ID, baseMsg.Type)
+				log.Println(p.GetID(), baseMsg.Type)
 
 				//--------------------------------
-				// Validate the identity
-				valid, err := validateIdentity(&baseMsg.Identity)
-				if err != nil {
-					log.Printf("Error validating identity: %v\n", err)
-					continue
-				}
-				if !valid {
-					log.Printf("Invalid identity: %v\n", baseMsg.Identity)
+				// Authenticate the message
+				if err := authenticate(p, baseMsg); err != nil {
+					log.Printf("Rejected %s message from player %s: %v\n", baseMsg.Type, p.GetID(), err)
+					code := shared.UnauthorizedErrorCode
+					if errors.Is(err, identity.ErrTokenExpired) {
+						code = shared.TokenExpiredErrorCode
+					}
+					p.WriteMessage(shared.TypedErrorMessage(code, err.Error()))
 					continue
 				}
 				//--------------------------------
@@ -96,7 +103,7 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 					{
 						var updateMsg UpdateIdentityMessage
 						if err := json.Unmarshal(msg, &updateMsg); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.ServerMessageChan <- updateMsg
@@ -104,9 +111,14 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 
 				case shared.MoveMessageType:
 					{
+						if p.GetSpectatingGameID() != "" {
+							log.Printf("Spectator %s tried to make a move\n", p.GetID())
+							p.WriteMessage(shared.TypedErrorMessage(shared.SpectatorCannotMoveErrorCode, "spectators cannot make moves"))
+							continue
+						}
 						var moveMsg shared.MoveMessage
 						if err := json.Unmarshal(msg, &moveMsg); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.GameMessageChan <- moveMsg
@@ -116,7 +128,7 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 					{
 						var closeMsg shared.CloseMessage
 						if err := json.Unmarshal(msg, &closeMsg); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						closeGameMessage := shared.CloseMessage{
@@ -128,7 +140,7 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 
 				case shared.RequestGameMessageType:
 					{
-						log.Printf("Player %s requested a game\n", p.Identity.ID)
+						log.Printf("Player %s requested a game\n", p.GetID())
 						p.ServerMessageChan <- shared.RequestGameMessage(baseMsg.Identity)
 					}
 
@@ -136,7 +148,7 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 					{
 						var leaveGameMessage shared.BaseClientMessage
 						if err := json.Unmarshal(msg, &leaveGameMessage); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.GameMessageChan <- leaveGameMessage
@@ -146,7 +158,7 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 					{
 						var leaveQueueMessage shared.BaseClientMessage
 						if err := json.Unmarshal(msg, &leaveQueueMessage); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.ServerMessageChan <- leaveQueueMessage
@@ -155,25 +167,98 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 					{
 						var joinInviteGameMessage shared.JoinInviteGameMessage
 						if err := json.Unmarshal(msg, &joinInviteGameMessage); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.ServerMessageChan <- joinInviteGameMessage
 					}
 				case shared.CreateInviteGameMessageType:
 					{
-						var createInviteGameMessage shared.BaseClientMessage
+						var createInviteGameMessage shared.CreateInviteGameMessage
 						if err := json.Unmarshal(msg, &createInviteGameMessage); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.ServerMessageChan <- createInviteGameMessage
 					}
+				case shared.RequestRematchMessageType, shared.AcceptRematchMessageType, shared.DeclineRematchMessageType:
+					{
+						var rematchMessage shared.BaseClientMessage
+						if err := json.Unmarshal(msg, &rematchMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.ServerMessageChan <- rematchMessage
+					}
+				case shared.PlayVsBotMessageType:
+					{
+						var playVsBotMessage shared.PlayVsBotMessage
+						if err := json.Unmarshal(msg, &playVsBotMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.ServerMessageChan <- playVsBotMessage
+					}
+				case shared.SpectateGameMessageType:
+					{
+						var spectateGameMessage shared.SpectateGameMessage
+						if err := json.Unmarshal(msg, &spectateGameMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.ServerMessageChan <- spectateGameMessage
+					}
+				case shared.StopSpectatingMessageType:
+					{
+						var stopSpectatingMessage shared.BaseClientMessage
+						if err := json.Unmarshal(msg, &stopSpectatingMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.ServerMessageChan <- stopSpectatingMessage
+					}
+				case shared.GetReplayMessageType:
+					{
+						var getReplayMessage shared.GetReplayMessage
+						if err := json.Unmarshal(msg, &getReplayMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.ServerMessageChan <- getReplayMessage
+					}
+				case shared.GetProfileMessageType:
+					{
+						var getProfileMessage shared.GetProfileMessage
+						if err := json.Unmarshal(msg, &getProfileMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.ServerMessageChan <- getProfileMessage
+					}
+				case shared.RequestHintMessageType:
+					{
+						// outside a game nothing would read the request
+						if !p.GetIsInGame() {
+							log.Printf("Player %s asked for a hint outside a game\n", p.GetID())
+							p.WriteMessage(shared.TypedErrorMessage(shared.NotInGameErrorCode, "not in a game"))
+							continue
+						}
+						var requestHintMessage shared.BaseClientMessage
+						if err := json.Unmarshal(msg, &requestHintMessage); err != nil {
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
+							continue
+						}
+						p.GameMessageChan <- requestHintMessage
+					}
+				case shared.RefreshTokenMessageType:
+					{
+						p.ServerMessageChan <- baseMsg
+					}
 				case shared.LeaveInviteGameMessageType:
 					{
 						var leaveInviteGameMessage shared.LeaveInviteGameMessage
 						if err := json.Unmarshal(msg, &leaveInviteGameMessage); err != nil {
-							log.Printf("Invalid JSON message from player %s: %v\n", p.Identity.ID, err)
+							log.Printf("Invalid JSON message from player %s: %v\n", p.GetID(), err)
 							continue
 						}
 						p.ServerMessageChan <- leaveInviteGameMessage
@@ -194,12 +279,12 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 						websocket.CloseGoingAway,
 						websocket.CloseAbnormalClosure,
 						websocket.CloseNoStatusReceived) {
-						log.Printf("Player %s disconnected gracefully\n", p.Identity.ID)
+						log.Printf("Player %s disconnected gracefully\n", p.GetID())
 					} else {
-						log.Printf("Unexpected error reading from player %s: %v\n", p.Identity.ID, err)
+						log.Printf("Unexpected error reading from player %s: %v\n", p.GetID(), err)
 					}
 
-					if p.IsInGame {
+					if p.GetIsInGame() {
 						p.GameMessageChan <- DisconnectedMessage{Player: p}
 					} else {
 						log.Println("Player not in game, sending error message")
@@ -213,13 +298,53 @@ func (p *Player) Listen(wg *sync.WaitGroup, validateIdentity func(*identity.Iden
 	}
 }
 
+// UpdateIdentity swaps p's identity for i. The identity is read through
+// GetID, GetIdentity and the other accessors below, never directly, since it
+// can be swapped while the game and the server read it.
 func (p *Player) UpdateIdentity(i identity.Identity) {
 	p.Mux.Lock()
 	defer p.Mux.Unlock()
 	p.Identity = &i
 }
 
+// SetRating stores rating on p's identity, leaving the rest of it as it is
+// right now.
+func (p *Player) SetRating(rating int) {
+	p.Mux.Lock()
+	defer p.Mux.Unlock()
+	updated := *p.Identity
+	updated.Rating = rating
+	p.Identity = &updated
+}
+
+func (p *Player) GetID() string {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	return p.Identity.ID
+}
+
+// GetIdentity returns a copy of p's identity, secret included.
+func (p *Player) GetIdentity() identity.Identity {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	return *p.Identity
+}
+
+func (p *Player) GetSafeIdentity() *identity.SafeIdentity {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	return p.Identity.GetSafeIdentity()
+}
+
+// WriteMessage is safe to call from several goroutines, since game loops,
+// the server and rematch timers all write to the same connection.
 func (p *Player) WriteMessage(message interface{}) error {
+	if p.IsBot() {
+		p.Bot.Notify(message)
+		return nil
+	}
+	p.WriteMux.Lock()
+	defer p.WriteMux.Unlock()
 	err := p.Conn.WriteJSON(message)
 	if err != nil {
 		log.Printf("error sending message to player %v\n", err)
@@ -240,6 +365,38 @@ func GenerateUniqueID() string {
 	return strings.ReplaceAll(encoded[:length], "-", "")
 }
 
+func (p *Player) SetSpectating(gameID string) {
+	p.Mux.Lock()
+	defer p.Mux.Unlock()
+	p.SpectatingGameID = gameID
+}
+
+func (p *Player) GetSpectatingGameID() string {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	return p.SpectatingGameID
+}
+
+// GetRating reads the rating of p's current identity, which is swapped
+// whenever the identity is updated.
+func (p *Player) GetRating() int {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	return p.Identity.Rating
+}
+
+// IsConnected reports whether p's connection is still open. Once it closes
+// the player's channels are closed too, so p cannot be put into a game.
+func (p *Player) IsConnected() bool {
+	return p.Ctx.Err() == nil
+}
+
+func (p *Player) GetIsInGame() bool {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	return p.IsInGame
+}
+
 func (p *Player) SetIsInGame(val bool) {
 	p.Mux.Lock()
 	defer p.Mux.Unlock()
@@ -26,6 +26,8 @@ type UpdateIdentityMessage struct {
 	Type    shared.MessageType `json:"type"`
 	Content struct {
 		Identity identity.Identity `json:"identity"`
+		// Token lets a returning player authenticate without the secret.
+		Token string `json:"token"`
 	} `json:"content"`
 }
 
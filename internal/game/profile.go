@@ -0,0 +1,170 @@
+package game
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+	"github.com/Monkhai/strixos-server.git/pkg/utils"
+)
+
+// PlayerStats are the lifetime results of one identity. Streaks count
+// consecutive wins; a loss or a draw ends the current one.
+type PlayerStats struct {
+	GamesPlayed   int   `json:"gamesPlayed"`
+	Wins          int   `json:"wins"`
+	Losses        int   `json:"losses"`
+	Draws         int   `json:"draws"`
+	CurrentStreak int   `json:"currentStreak"`
+	BestStreak    int   `json:"bestStreak"`
+	TotalMoves    int   `json:"totalMoves"`
+	TotalTimeMs   int64 `json:"totalTimeMs"`
+}
+
+func (s PlayerStats) AverageMoves() float64 {
+	if s.GamesPlayed == 0 {
+		return 0
+	}
+	return float64(s.TotalMoves) / float64(s.GamesPlayed)
+}
+
+func (s PlayerStats) AverageTimeMs() int64 {
+	if s.GamesPlayed == 0 {
+		return 0
+	}
+	return s.TotalTimeMs / int64(s.GamesPlayed)
+}
+
+func (s *PlayerStats) record(result ReplayResult, id string, moves int, length time.Duration) {
+	s.GamesPlayed++
+	s.TotalMoves += moves
+	s.TotalTimeMs += length.Milliseconds()
+	switch {
+	case result.IsDraw:
+		{
+			s.Draws++
+			s.CurrentStreak = 0
+		}
+	case result.WinnerID == id:
+		{
+			s.Wins++
+			s.CurrentStreak++
+			s.BestStreak = max(s.BestStreak, s.CurrentStreak)
+		}
+	default:
+		{
+			s.Losses++
+			s.CurrentStreak = 0
+		}
+	}
+}
+
+// Profile is what anyone can see about a player: the public part of their
+// identity and their stats.
+type Profile struct {
+	Identity      *identity.SafeIdentity `json:"identity"`
+	Stats         PlayerStats            `json:"stats"`
+	AverageMoves  float64                `json:"averageMoves"`
+	AverageTimeMs int64                  `json:"averageTimeMs"`
+}
+
+func NewProfile(i *identity.SafeIdentity, stats PlayerStats) Profile {
+	return Profile{
+		Identity:      i,
+		Stats:         stats,
+		AverageMoves:  stats.AverageMoves(),
+		AverageTimeMs: stats.AverageTimeMs(),
+	}
+}
+
+func ProfileMessage(profile Profile) shared.GenericMessage {
+	return shared.GenericMessage{
+		Type: shared.ProfileMessageType,
+		Content: map[string]any{
+			"profile": profile,
+		},
+	}
+}
+
+// ProfileStore keeps the stats of every human player, keyed by identity ID.
+// A store from LoadProfileStore is written back to its file after every
+// game; one from NewProfileStore lives in memory only.
+type ProfileStore struct {
+	Map  map[string]*PlayerStats
+	Mux  *sync.RWMutex
+	file *utils.AtomicFile
+}
+
+func NewProfileStore() *ProfileStore {
+	return &ProfileStore{
+		Map: make(map[string]*PlayerStats),
+		Mux: &sync.RWMutex{},
+	}
+}
+
+// LoadProfileStore reads the stats saved at path, starting from none if the
+// file does not exist yet.
+func LoadProfileStore(path string) (*ProfileStore, error) {
+	store := NewProfileStore()
+	store.file = utils.NewAtomicFile(path, 0o644)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.Map); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// RecordGame adds a finished game to the stats of both players. Bots have no
+// profile.
+func (p *ProfileStore) RecordGame(replay *Replay) {
+	length := replay.EndedAt.Sub(replay.StartedAt)
+	p.Mux.Lock()
+	for _, player := range replay.Players {
+		if player.IsBot {
+			continue
+		}
+		stats, ok := p.Map[player.ID]
+		if !ok {
+			stats = &PlayerStats{}
+			p.Map[player.ID] = stats
+		}
+		stats.record(replay.Result, player.ID, len(replay.Moves), length)
+	}
+	p.Mux.Unlock()
+	p.save()
+}
+
+// GetStats returns a copy of the player's stats, all zero if they have not
+// finished a game yet.
+func (p *ProfileStore) GetStats(id string) PlayerStats {
+	p.Mux.RLock()
+	defer p.Mux.RUnlock()
+	if stats, ok := p.Map[id]; ok {
+		return *stats
+	}
+	return PlayerStats{}
+}
+
+func (p *ProfileStore) save() {
+	if p.file == nil {
+		return
+	}
+	err := p.file.Save(func() ([]byte, error) {
+		p.Mux.RLock()
+		defer p.Mux.RUnlock()
+		return json.Marshal(p.Map)
+	})
+	if err != nil {
+		log.Printf("error saving profiles: %s\n", err)
+	}
+}
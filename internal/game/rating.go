@@ -0,0 +1,51 @@
+package game
+
+// RatingChange is how one rated game moved a player's rating.
+type RatingChange struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+	Delta  int `json:"delta"`
+}
+
+// RatingStakes is what a player stands to gain or lose before a rated game
+// starts.
+type RatingStakes struct {
+	Rating int `json:"rating"`
+	Win    int `json:"win"`
+	Draw   int `json:"draw"`
+	Loss   int `json:"loss"`
+}
+
+// Rater keeps the ratings of a rated game's players. Both maps are keyed by
+// player ID. A game without a Rater is unrated.
+type Rater interface {
+	Stakes(g *Game) map[string]RatingStakes
+	Rate(g *Game, result GameResult) map[string]RatingChange
+}
+
+// RateResult applies the result to the players' ratings and returns it with
+// the changes attached. Unrated games return the result unchanged.
+func (g *Game) RateResult(result GameResult) GameResult {
+	if g.Rater == nil {
+		return result
+	}
+	result.RatingChanges = g.Rater.Rate(g, result)
+	return result
+}
+
+// OptInToRating records that p wants this game rated. Invite games are only
+// rated when both players opted in.
+func (g *Game) OptInToRating(p *Player) {
+	g.Mux.Lock()
+	defer g.Mux.Unlock()
+	if g.RatingOptIns == nil {
+		g.RatingOptIns = make(map[string]bool)
+	}
+	g.RatingOptIns[p.GetID()] = true
+}
+
+func (g *Game) BothOptedIn() bool {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+	return g.RatingOptIns[g.Player1.GetID()] && g.RatingOptIns[g.Player2.GetID()]
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"log"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+// ReconnectedMessage hands Run the new connection of a player who is
+// already in the game.
+type ReconnectedMessage struct {
+	Player *Player
+}
+
+func (g *Game) HasPlayer(id string) bool {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+	return (g.Player1 != nil && g.Player1.GetID() == id) || (g.Player2 != nil && g.Player2.GetID() == id)
+}
+
+func (g *Game) Opponent(p *Player) *Player {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+	if g.Player1.GetID() == p.GetID() {
+		return g.Player2
+	}
+	return g.Player1
+}
+
+// replacePlayer swaps the player holding p's identity for p and returns the
+// player that was replaced.
+func (g *Game) replacePlayer(p *Player) *Player {
+	g.Mux.Lock()
+	defer g.Mux.Unlock()
+	var old *Player
+	if g.Player1.GetID() == p.GetID() {
+		old, g.Player1 = g.Player1, p
+	} else {
+		old, g.Player2 = g.Player2, p
+	}
+	if g.ActivePlayer == old {
+		g.ActivePlayer = p
+	}
+	return old
+}
+
+// Reconnect hands p's new connection to the running game. It reports false
+// if the game is already over.
+func (g *Game) Reconnect(p *Player) bool {
+	select {
+	case <-g.Ctx.Done():
+		return false
+	case g.ReconnectChan <- ReconnectedMessage{Player: p}:
+		return true
+	}
+}
+
+// ResyncMessage is the full game state for a player who just reconnected:
+// everything in the start message plus the moves played so far.
+func (g *Game) ResyncMessage(p *Player) shared.GenericMessage {
+	message := g.NewGameMessage(g.GetMark(p), g.GetActivePlayer(), g.Opponent(p))
+	message.Type = shared.ResyncGameMessageType
+	g.Mux.RLock()
+	message.Content["history"] = append([]MoveRecord(nil), g.History...)
+	g.Mux.RUnlock()
+	message.Content["spectators"] = g.SpectatorCount()
+	return message
+}
+
+// graceExpiry is posted when a grace period runs out. Drop numbers the
+// player's drops, so an expiry from an earlier drop that was already posted
+// when the player came back can be told apart from the current one.
+type graceExpiry struct {
+	Player *Player
+	Drop   int
+}
+
+// waitForReconnect starts p's grace period. The opponent is told p is
+// reconnecting, and p is posted on expired if they are not back in time. The
+// returned timer is stopped when p reconnects.
+func (g *Game) waitForReconnect(p *Player, drop int, expired chan<- graceExpiry) *time.Timer {
+	log.Printf("Player %s disconnected, waiting %s for them to reconnect\n", p.GetID(), g.ReconnectGrace)
+	g.Opponent(p).WriteMessage(shared.OpponentReconnectingMessage(g.ReconnectGrace.Milliseconds()))
+	return time.AfterFunc(g.ReconnectGrace, func() {
+		select {
+		case expired <- graceExpiry{Player: p, Drop: drop}:
+		case <-g.Ctx.Done():
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package game
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+const MAX_STORED_REPLAYS = 1000
+
+// MoveRecord is a single move as it was played. Board is the board right
+// after the move, and Events lists what the engine reported for it: the
+// placement, every piece that decayed or vanished and the end of the game.
+type MoveRecord struct {
+	Number    int             `json:"number"`
+	PlayerID  string          `json:"playerID"`
+	Mark      string          `json:"mark"`
+	Row       int             `json:"row"`
+	Col       int             `json:"col"`
+	Timestamp time.Time       `json:"timestamp"`
+	Events    []engine.Event  `json:"events"`
+	Board     [][]engine.Cell `json:"board"`
+}
+
+type ReplayResult struct {
+	WinnerID string         `json:"winnerID"`
+	IsDraw   bool           `json:"isDraw"`
+	Reason   GameOverReason `json:"reason"`
+}
+
+type Replay struct {
+	GameID      string                            `json:"gameID"`
+	SeriesID    string                            `json:"seriesID,omitempty"`
+	Players     map[string]*identity.SafeIdentity `json:"players"`
+	BoardConfig BoardConfig                       `json:"boardConfig"`
+	Rules       RuleSet                           `json:"rules"`
+	Moves       []MoveRecord                      `json:"moves"`
+	Result      ReplayResult                      `json:"result"`
+	HintsUsed   map[string]int                    `json:"hintsUsed"`
+	Analysis    *Analysis                         `json:"analysis,omitempty"`
+	StartedAt   time.Time                         `json:"startedAt"`
+	EndedAt     time.Time                         `json:"endedAt"`
+}
+
+func (g *Game) RecordMove(p *Player, state engine.State, row, col int, events []engine.Event) {
+	g.Mux.Lock()
+	defer g.Mux.Unlock()
+	g.History = append(g.History, MoveRecord{
+		Number:    len(g.History) + 1,
+		PlayerID:  p.GetID(),
+		Mark:      g.GetMark(p),
+		Row:       row,
+		Col:       col,
+		Timestamp: time.Now(),
+		Events:    events,
+		Board:     state.Cells(),
+	})
+}
+
+// NewReplay freezes the game's history once it has ended.
+func (g *Game) NewReplay(result GameResult) *Replay {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+
+	replay := &Replay{
+		GameID: g.ID,
+		Players: map[string]*identity.SafeIdentity{
+			MARK_X: g.Player1.GetSafeIdentity(),
+			MARK_O: g.Player2.GetSafeIdentity(),
+		},
+		BoardConfig: g.Board.Config,
+		Rules:       g.Rules,
+		Moves:       append([]MoveRecord(nil), g.History...),
+		Result: ReplayResult{
+			IsDraw: result.IsDraw(),
+			Reason: result.Reason,
+		},
+		HintsUsed: maps.Clone(g.HintsUsed),
+		StartedAt: g.StartedAt,
+		EndedAt:   time.Now(),
+	}
+	if result.Winner != nil {
+		replay.Result.WinnerID = result.Winner.GetID()
+	}
+	if g.Series != nil {
+		replay.SeriesID = g.Series.ID
+	}
+	return replay
+}
+
+func ReplayMessage(replay *Replay) shared.GenericMessage {
+	return shared.GenericMessage{
+		Type: shared.ReplayMessageType,
+		Content: map[string]any{
+			"replay": replay,
+		},
+	}
+}
+
+// ReplayStore keeps the most recent finished games in memory, dropping the
+// oldest once it is full.
+type ReplayStore struct {
+	Map   map[string]*Replay
+	Order []string
+	Limit int
+	Mux   *sync.RWMutex
+}
+
+func NewReplayStore(limit int) *ReplayStore {
+	return &ReplayStore{
+		Map:   make(map[string]*Replay),
+		Limit: limit,
+		Mux:   &sync.RWMutex{},
+	}
+}
+
+func (r *ReplayStore) AddReplay(replay *Replay) {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+	if _, exists := r.Map[replay.GameID]; !exists {
+		r.Order = append(r.Order, replay.GameID)
+	}
+	r.Map[replay.GameID] = replay
+
+	for len(r.Order) > r.Limit {
+		delete(r.Map, r.Order[0])
+		r.Order = r.Order[1:]
+	}
+}
+
+// SetAnalysis attaches a finished analysis to a stored replay. The replay is
+// copied rather than changed in place, since it may be being sent to a
+// client at the same time.
+func (r *ReplayStore) SetAnalysis(analysis *Analysis) {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+	replay, ok := r.Map[analysis.GameID]
+	if !ok {
+		return
+	}
+	analysed := *replay
+	analysed.Analysis = analysis
+	r.Map[analysis.GameID] = &analysed
+}
+
+func (r *ReplayStore) GetReplay(gameID string) (*Replay, bool) {
+	r.Mux.RLock()
+	defer r.Mux.RUnlock()
+	replay, ok := r.Map[gameID]
+	return replay, ok
+}
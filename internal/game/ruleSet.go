@@ -0,0 +1,66 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
+)
+
+type DecayMode = engine.DecayMode
+
+const (
+	DECAY_PER_MOVE  = engine.DECAY_PER_MOVE
+	DECAY_PER_ROUND = engine.DECAY_PER_ROUND
+	DECAY_OFF       = engine.DECAY_OFF
+)
+
+const (
+	MIN_INITIAL_LIVES = 1
+	MAX_INITIAL_LIVES = 20
+	MAX_MOVES_LIMIT   = 1000
+)
+
+// RuleSet controls the vanishing-piece mechanic and the clocks of a single
+// game. A MaxMoves of zero means the game has no move cap.
+type RuleSet struct {
+	InitialLives int         `json:"initialLives"`
+	Decay        DecayMode   `json:"decay"`
+	MaxMoves     int         `json:"maxMoves"`
+	TimeControl  TimeControl `json:"timeControl"`
+}
+
+var DefaultRuleSet = RuleSet{InitialLives: INITIAL_LIVES, Decay: DECAY_PER_MOVE, TimeControl: DefaultTimeControl}
+
+// NewRuleSet builds a rule set from client supplied values. Zero values fall
+// back to the default rules.
+func NewRuleSet(initialLives int, decay string, maxMoves int, timeControl TimeControl) (RuleSet, error) {
+	rules := DefaultRuleSet
+	if initialLives != 0 {
+		rules.InitialLives = initialLives
+	}
+	if decay != "" {
+		rules.Decay = DecayMode(decay)
+	}
+	if maxMoves != 0 {
+		rules.MaxMoves = maxMoves
+	}
+	if !timeControl.IsZero() {
+		rules.TimeControl = timeControl
+	}
+	return rules, rules.Validate()
+}
+
+func (r RuleSet) Validate() error {
+	switch r.Decay {
+	case DECAY_PER_MOVE, DECAY_PER_ROUND, DECAY_OFF:
+	default:
+		return fmt.Errorf("%w: unknown decay mode %q", ErrInvalidRuleSet, r.Decay)
+	}
+	if r.InitialLives < MIN_INITIAL_LIVES || r.InitialLives > MAX_INITIAL_LIVES {
+		return fmt.Errorf("%w: initial lives must be between %d and %d", ErrInvalidRuleSet, MIN_INITIAL_LIVES, MAX_INITIAL_LIVES)
+	}
+	if r.MaxMoves < 0 || r.MaxMoves > MAX_MOVES_LIMIT {
+		return fmt.Errorf("%w: max moves must be between 0 and %d", ErrInvalidRuleSet, MAX_MOVES_LIMIT)
+	}
+	return r.TimeControl.Validate()
+}
@@ -0,0 +1,131 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+	"github.com/Monkhai/strixos-server.git/pkg/utils"
+)
+
+const MAX_SERIES_LENGTH = 7
+
+// Series is a best-of-N match between the same two players. Each game in the
+// series is a regular Game pointing back at it; the server swaps who moves
+// first between games. Drawn games count towards the games played but give
+// no point, so a series can end tied.
+type Series struct {
+	ID          string         `json:"id"`
+	BestOf      int            `json:"bestOf"`
+	GamesPlayed int            `json:"gamesPlayed"`
+	Draws       int            `json:"draws"`
+	Scores      map[string]int `json:"scores"`
+	Mux         *sync.RWMutex  `json:"-"`
+	// ForfeitedBy is the player who left between games, ending the series
+	ForfeitedBy string `json:"forfeitedBy,omitempty"`
+}
+
+func ValidateSeriesLength(bestOf int) error {
+	if bestOf < 1 || bestOf > MAX_SERIES_LENGTH || bestOf%2 == 0 {
+		return fmt.Errorf("%w: best of must be an odd number between 1 and %d", ErrInvalidSeries, MAX_SERIES_LENGTH)
+	}
+	return nil
+}
+
+func NewSeries(bestOf int) *Series {
+	return &Series{
+		ID:     utils.GenerateUniqueID(),
+		BestOf: bestOf,
+		Scores: make(map[string]int),
+		Mux:    &sync.RWMutex{},
+	}
+}
+
+func (s *Series) RecordResult(result GameResult) {
+	s.Mux.Lock()
+	defer s.Mux.Unlock()
+	s.GamesPlayed++
+	if result.IsDraw() {
+		s.Draws++
+		return
+	}
+	s.Scores[result.Winner.GetID()]++
+}
+
+// Forfeit ends the series in favour of the other player, who is given
+// enough points to have won it.
+func (s *Series) Forfeit(loser *Player, players [2]*Player) {
+	s.Mux.Lock()
+	defer s.Mux.Unlock()
+	winner := players[0]
+	if winner.GetID() == loser.GetID() {
+		winner = players[1]
+	}
+	s.ForfeitedBy = loser.GetID()
+	s.Scores[winner.GetID()] = max(s.Scores[winner.GetID()], s.BestOf/2+1)
+}
+
+func (s *Series) IsOver() bool {
+	s.Mux.RLock()
+	defer s.Mux.RUnlock()
+	if s.GamesPlayed >= s.BestOf {
+		return true
+	}
+	for _, score := range s.Scores {
+		if score > s.BestOf/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Winner returns the player with the higher score, or nil if the series is tied.
+func (s *Series) Winner(players [2]*Player) *Player {
+	s.Mux.RLock()
+	defer s.Mux.RUnlock()
+	first, second := s.Scores[players[0].GetID()], s.Scores[players[1].GetID()]
+	switch {
+	case first > second:
+		return players[0]
+	case second > first:
+		return players[1]
+	default:
+		return nil
+	}
+}
+
+func (s *Series) content() map[string]any {
+	s.Mux.RLock()
+	defer s.Mux.RUnlock()
+	scores := make(map[string]int, len(s.Scores))
+	for id, score := range s.Scores {
+		scores[id] = score
+	}
+	return map[string]any{
+		"seriesID":    s.ID,
+		"bestOf":      s.BestOf,
+		"gamesPlayed": s.GamesPlayed,
+		"draws":       s.Draws,
+		"scores":      scores,
+		"forfeitedBy": s.ForfeitedBy,
+	}
+}
+
+func SeriesProgressMessage(s *Series) shared.GenericMessage {
+	return shared.GenericMessage{
+		Type:    shared.SeriesProgressMessageType,
+		Content: s.content(),
+	}
+}
+
+func SeriesOverMessage(s *Series, players [2]*Player) shared.GenericMessage {
+	content := s.content()
+	content["winner"] = nil
+	if winner := s.Winner(players); winner != nil {
+		content["winner"] = winner.GetSafeIdentity()
+	}
+	return shared.GenericMessage{
+		Type:    shared.SeriesOverMessageType,
+		Content: content,
+	}
+}
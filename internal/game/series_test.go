@@ -0,0 +1,26 @@
+package game
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSeriesForfeit(t *testing.T) {
+	players := [2]*Player{NewBotPlayer(BOT_EASY, context.Background()), NewBotPlayer(BOT_EASY, context.Background())}
+	s := NewSeries(5)
+	s.RecordResult(GameResult{Winner: players[0], Reason: REASON_WIN})
+	if s.IsOver() {
+		t.Fatalf("series over after one game of five")
+	}
+
+	s.Forfeit(players[0], players)
+	if !s.IsOver() {
+		t.Fatalf("series goes on after a forfeit")
+	}
+	if winner := s.Winner(players); winner != players[1] {
+		t.Errorf("Winner() = %v, want the player who stayed", winner)
+	}
+	if s.ForfeitedBy != players[0].GetID() {
+		t.Errorf("ForfeitedBy = %q, want %q", s.ForfeitedBy, players[0].GetID())
+	}
+}
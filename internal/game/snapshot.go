@@ -0,0 +1,213 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/engine"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+	"github.com/Monkhai/strixos-server.git/pkg/utils"
+)
+
+const SNAPSHOT_FILE_EXT = ".json"
+
+// GameSnapshot is everything needed to bring a live game back after a
+// restart. The engine is deterministic, so the position (lives, turn and
+// repetition history included) is rebuilt by replaying History; Board and
+// ToMove are kept alongside so a snapshot can be read on its own. Players
+// carry their full identities, secrets included, so the same people can
+// authenticate again once the server is back.
+type GameSnapshot struct {
+	ID            string               `json:"id"`
+	Mode          string               `json:"mode"`
+	BoardConfig   BoardConfig          `json:"boardConfig"`
+	Rules         RuleSet              `json:"rules"`
+	Board         [][]engine.Cell      `json:"board"`
+	ToMove        string               `json:"toMove"`
+	Players       [2]identity.Identity `json:"players"`
+	BotDifficulty BotDifficulty        `json:"botDifficulty,omitempty"`
+	Clocks        map[string]int64     `json:"clocks"`
+	History       []MoveRecord         `json:"history"`
+	HintsUsed     map[string]int       `json:"hintsUsed"`
+	Series        *Series              `json:"series,omitempty"`
+	Rated         bool                 `json:"rated,omitempty"`
+	StartedAt     time.Time            `json:"startedAt"`
+	SavedAt       time.Time            `json:"savedAt"`
+}
+
+// Snapshot captures g as it is right now. The running clock is charged up to
+// this moment, so no time is lost or gained across a restart.
+func (g *Game) Snapshot() GameSnapshot {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+
+	state := g.Board.GetState()
+	snapshot := GameSnapshot{
+		ID:          g.ID,
+		Mode:        g.Mode.Name(),
+		BoardConfig: g.Board.Config,
+		Rules:       g.Rules,
+		Board:       state.Cells(),
+		ToMove:      state.ToMove(),
+		Players:     [2]identity.Identity{g.Player1.GetIdentity(), g.Player2.GetIdentity()},
+		Clocks:      g.Clock.Snapshot(),
+		History:     append([]MoveRecord(nil), g.History...),
+		HintsUsed:   maps.Clone(g.HintsUsed),
+		Rated:       g.Rater != nil,
+		StartedAt:   g.StartedAt,
+		SavedAt:     time.Now(),
+	}
+	if g.Series != nil {
+		g.Series.Mux.RLock()
+		series := *g.Series
+		series.Scores = maps.Clone(g.Series.Scores)
+		g.Series.Mux.RUnlock()
+		snapshot.Series = &series
+	}
+	for _, p := range [2]*Player{g.Player1, g.Player2} {
+		if p.IsBot() {
+			snapshot.BotDifficulty = p.Bot.Difficulty
+		}
+	}
+	return snapshot
+}
+
+// RestoreGame rebuilds a game from its snapshot for the given players, who
+// must hold the snapshot's identities in the same order. The game is not
+// started; Run picks up with whoever is to move.
+func RestoreGame(snapshot GameSnapshot, players [2]*Player, parentCtx context.Context) (*Game, error) {
+	if err := ValidateConfig(snapshot.BoardConfig, snapshot.Rules); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	state := engine.NewState(EngineConfig(snapshot.BoardConfig, snapshot.Rules))
+	for _, record := range snapshot.History {
+		next, _, err := engine.Apply(state, engine.Move{Row: record.Row, Col: record.Col})
+		if err != nil {
+			return nil, fmt.Errorf("%w: move %d: %w", ErrInvalidSnapshot, record.Number, err)
+		}
+		state = next
+	}
+	if state.IsOver() {
+		return nil, fmt.Errorf("%w: game is already over", ErrInvalidSnapshot)
+	}
+
+	g, err := NewGame(players, snapshot.BoardConfig, snapshot.Rules, parentCtx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	g.ID = snapshot.ID
+	g.Board.SetState(state)
+	g.History = snapshot.History
+	g.StartedAt = snapshot.StartedAt
+	for id, count := range snapshot.HintsUsed {
+		g.HintsUsed[id] = count
+	}
+	if snapshot.Series != nil {
+		g.Series = snapshot.Series
+		g.Series.Mux = &sync.RWMutex{}
+	}
+
+	g.Clock = NewClock(snapshot.Rules.TimeControl, players)
+	for id, ms := range snapshot.Clocks {
+		if _, ok := g.Clock.Remaining[id]; ok {
+			g.Clock.Remaining[id] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return g, nil
+}
+
+// SnapshotStore keeps one file per live game in Dir, each replaced whole by
+// utils.WriteFileAtomic.
+type SnapshotStore struct {
+	Dir string
+	Mux *sync.Mutex
+}
+
+func NewSnapshotStore(dir string) *SnapshotStore {
+	return &SnapshotStore{
+		Dir: dir,
+		Mux: &sync.Mutex{},
+	}
+}
+
+// SaveAll writes every snapshot and removes the files of games that are no
+// longer live.
+func (s *SnapshotStore) SaveAll(snapshots []GameSnapshot) error {
+	s.Mux.Lock()
+	defer s.Mux.Unlock()
+
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	live := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		if err := s.write(snapshot); err != nil {
+			return err
+		}
+		live[snapshot.ID+SNAPSHOT_FILE_EXT] = true
+	}
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), SNAPSHOT_FILE_EXT) || live[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.Dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SnapshotStore) write(snapshot GameSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(s.Dir, snapshot.ID+SNAPSHOT_FILE_EXT), data, 0o600)
+}
+
+// LoadAll reads every snapshot in Dir. Files that cannot be read are logged
+// and skipped, so one bad file does not keep the other games from coming back.
+func (s *SnapshotStore) LoadAll() ([]GameSnapshot, error) {
+	s.Mux.Lock()
+	defer s.Mux.Unlock()
+
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []GameSnapshot
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), SNAPSHOT_FILE_EXT) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Dir, entry.Name()))
+		if err != nil {
+			log.Printf("error reading snapshot %s: %s\n", entry.Name(), err)
+			continue
+		}
+		var snapshot GameSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			log.Printf("error decoding snapshot %s: %s\n", entry.Name(), err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
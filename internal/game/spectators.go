@@ -0,0 +1,98 @@
+package game
+
+import (
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+// AddSpectator subscribes p to the game's broadcasts and returns the new
+// spectator count. Spectators only ever receive messages; their moves are
+// never read by the game loop.
+func (g *Game) AddSpectator(p *Player) int {
+	g.Mux.Lock()
+	g.Spectators[p.GetID()] = p
+	count := len(g.Spectators)
+	g.Mux.Unlock()
+
+	p.SetSpectating(g.ID)
+	g.notifySpectatorCount(count)
+	return count
+}
+
+func (g *Game) RemoveSpectator(p *Player) {
+	g.Mux.Lock()
+	_, ok := g.Spectators[p.GetID()]
+	delete(g.Spectators, p.GetID())
+	count := len(g.Spectators)
+	g.Mux.Unlock()
+
+	p.SetSpectating("")
+	if ok {
+		g.notifySpectatorCount(count)
+	}
+}
+
+// RemoveAllSpectators is called once the game is over.
+func (g *Game) RemoveAllSpectators() {
+	g.Mux.Lock()
+	spectators := g.Spectators
+	g.Spectators = make(map[string]*Player)
+	g.Mux.Unlock()
+
+	for _, p := range spectators {
+		p.SetSpectating("")
+	}
+}
+
+func (g *Game) SpectatorCount() int {
+	g.Mux.RLock()
+	defer g.Mux.RUnlock()
+	return len(g.Spectators)
+}
+
+func (g *Game) notifySpectatorCount(count int) {
+	msg := shared.SpectatorsUpdateMessage(count)
+	g.Player1.WriteMessage(msg)
+	g.Player2.WriteMessage(msg)
+}
+
+// WriteToSpectators sends message to every spectator of the game.
+func (g *Game) WriteToSpectators(message interface{}) {
+	g.Mux.RLock()
+	spectators := make([]*Player, 0, len(g.Spectators))
+	for _, p := range g.Spectators {
+		spectators = append(spectators, p)
+	}
+	g.Mux.RUnlock()
+
+	for _, p := range spectators {
+		p.WriteMessage(message)
+	}
+}
+
+// Broadcast sends message to both players and every spectator.
+func (g *Game) Broadcast(message interface{}) {
+	g.Player1.WriteMessage(message)
+	g.Player2.WriteMessage(message)
+	g.WriteToSpectators(message)
+}
+
+func (g *Game) SpectatorStartMessage() shared.GenericMessage {
+	content := map[string]any{
+		"board":        g.Board.Cells(),
+		"boardConfig":  g.Board.Config,
+		"rules":        g.Rules,
+		"players":      map[string]any{MARK_X: g.Player1.GetSafeIdentity(), MARK_O: g.Player2.GetSafeIdentity()},
+		"activePlayer": g.GetActivePlayer().GetSafeIdentity(),
+		"gameID":       g.ID,
+		"clocks":       g.Clock.Snapshot(),
+		"spectator":    true,
+		"spectators":   g.SpectatorCount(),
+	}
+	if g.Series != nil {
+		content["series"] = g.Series.content()
+	}
+	return shared.GenericMessage{
+		Type:    shared.StartGameMessageType,
+		Content: content,
+	}
+}
@@ -0,0 +1,249 @@
+package identity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MIN_DISPLAY_NAME_LENGTH = 2
+	MAX_DISPLAY_NAME_LENGTH = 24
+	// MAX_COMBINING_MARKS caps the accents stacked on one letter, which is
+	// enough for real scripts and keeps out "zalgo" text.
+	MAX_COMBINING_MARKS = 2
+	// DISPLAY_NAME_PUNCTUATION is the punctuation allowed inside a name, on
+	// top of letters, digits and single spaces.
+	DISPLAY_NAME_PUNCTUATION = "-_.'"
+)
+
+// NameValidator enforces the display name rules. Filter may be nil, in which
+// case no words are blocked.
+type NameValidator struct {
+	MinLength int
+	MaxLength int
+	Filter    *WordFilter
+}
+
+func NewNameValidator(filter *WordFilter) *NameValidator {
+	return &NameValidator{
+		MinLength: MIN_DISPLAY_NAME_LENGTH,
+		MaxLength: MAX_DISPLAY_NAME_LENGTH,
+		Filter:    filter,
+	}
+}
+
+// Normalize returns the name as it will be stored and shown: composed to
+// Unicode NFC, so an accent typed as its own code point looks the same as a
+// precomposed one, with surrounding whitespace trimmed and every run of
+// whitespace inside it turned into a single space. It rejects names that break the length or character rules
+// or contain a blocked word.
+func (v *NameValidator) Normalize(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("%w: not valid UTF-8", ErrInvalidDisplayName)
+	}
+
+	var normalized strings.Builder
+	pendingSpace := false
+	marks := 0
+	hasAlphanumeric := false
+	// onAlphanumeric is whether the last rune, marks aside, was a letter or a digit
+	onAlphanumeric := false
+	for _, r := range norm.NFC.String(name) {
+		switch {
+		case unicode.IsSpace(r):
+			{
+				pendingSpace = normalized.Len() > 0
+				marks = 0
+				onAlphanumeric = false
+				continue
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			{
+				hasAlphanumeric = true
+				onAlphanumeric = true
+				marks = 0
+			}
+		case unicode.Is(unicode.M, r):
+			{
+				// a mark has to sit on a letter, and only a few of them
+				if !onAlphanumeric || marks >= MAX_COMBINING_MARKS {
+					return "", fmt.Errorf("%w: misplaced accent %U", ErrInvalidDisplayName, r)
+				}
+				marks++
+			}
+		case strings.ContainsRune(DISPLAY_NAME_PUNCTUATION, r):
+			{
+				marks = 0
+				onAlphanumeric = false
+			}
+		default:
+			{
+				return "", fmt.Errorf("%w: character %q is not allowed", ErrInvalidDisplayName, r)
+			}
+		}
+
+		if pendingSpace {
+			normalized.WriteByte(' ')
+			pendingSpace = false
+		}
+		normalized.WriteRune(r)
+	}
+
+	result := normalized.String()
+	length := utf8.RuneCountInString(result)
+	if length < v.MinLength || length > v.MaxLength {
+		return "", fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidDisplayName, v.MinLength, v.MaxLength)
+	}
+	if !hasAlphanumeric {
+		return "", fmt.Errorf("%w: must contain a letter or a digit", ErrInvalidDisplayName)
+	}
+	if v.Filter != nil && v.Filter.Blocks(result) {
+		return "", ErrOffensiveDisplayName
+	}
+	return result, nil
+}
+
+// WordFilter blocks names made of any of its words. Names are folded and
+// split into tokens first (see foldForFilter), and a word matches a token or
+// a run of adjacent tokens, so "B@dW0rd", "bad word" and "baaadword" are
+// caught while a word inside a longer one, like "ass" in "Grass", is not.
+type WordFilter struct {
+	words [][]rune
+}
+
+func NewWordFilter(words []string) *WordFilter {
+	filter := &WordFilter{}
+	for _, word := range words {
+		if folded := strings.Join(foldForFilter(word), ""); folded != "" {
+			filter.words = append(filter.words, []rune(folded))
+		}
+	}
+	return filter
+}
+
+// LoadWordFilter reads a word list with one word per line. Empty lines and
+// lines starting with # are skipped.
+func LoadWordFilter(path string) (*WordFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordFilter(words), nil
+}
+
+func (f *WordFilter) Blocks(name string) bool {
+	tokens := foldForFilter(name)
+	for first := range tokens {
+		candidate := ""
+		for _, token := range tokens[first:] {
+			candidate += token
+			for _, word := range f.words {
+				if stretches([]rune(candidate), word) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stretches reports whether candidate is word with some of its letters
+// repeated, as in "baaadword" for "badword". A letter that is doubled in the
+// word has to be at least doubled in the candidate.
+func stretches(candidate, word []rune) bool {
+	i, j := 0, 0
+	for i < len(candidate) && j < len(word) {
+		letter := word[j]
+		wordRun := 0
+		for j < len(word) && word[j] == letter {
+			j++
+			wordRun++
+		}
+		candidateRun := 0
+		for i < len(candidate) && candidate[i] == letter {
+			i++
+			candidateRun++
+		}
+		if candidateRun < wordRun {
+			return false
+		}
+	}
+	return i == len(candidate) && j == len(word)
+}
+
+// lookalikes maps digits and symbols to the plain letter they are usually
+// standing in for, and Cyrillic and Greek letters to the Latin letter they
+// look like. Accents are stripped separately.
+var lookalikes = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+	'æ': 'a', 'ø': 'o', 'ß': 's', 'ı': 'i', 'ł': 'l', 'đ': 'd',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'з': 'e', 'і': 'i', 'ї': 'i', 'ј': 'j',
+	'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'п': 'n', 'р': 'p', 'с': 'c', 'т': 't',
+	'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ь': 'b', 'г': 'r',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'μ': 'u', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'γ': 'y',
+}
+
+// foldForFilter reduces s to lowercase Latin tokens so that disguised words
+// fold to the same letters as the word itself. Compatibility characters
+// (fullwidth, mathematical bold and the like) are first mapped to their
+// plain form with NFKC, then lookalikes are replaced and accents dropped.
+// Tokens are runs of letters, split at anything else and where a lowercase
+// letter is followed by an uppercase one, as in "BadWord".
+func foldForFilter(s string) []string {
+	var tokens []string
+	var token strings.Builder
+	endToken := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+
+	lastLower := false
+	for _, r := range norm.NFD.String(norm.NFKC.String(s)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		upper := unicode.IsUpper(r)
+		r = unicode.ToLower(r)
+		if plain, ok := lookalikes[r]; ok {
+			r = plain
+		}
+		if !unicode.IsLetter(r) {
+			endToken()
+			lastLower = false
+			continue
+		}
+		if upper && lastLower {
+			endToken()
+		}
+		token.WriteRune(r)
+		lastLower = !upper
+	}
+	endToken()
+	return tokens
+}
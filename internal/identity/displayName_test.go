@@ -0,0 +1,94 @@
+package identity
+
+import (
+	"errors"
+	"testing"
+)
+
+func testValidator() *NameValidator {
+	return NewNameValidator(NewWordFilter([]string{"badword", "ass", "hell", "tit"}))
+}
+
+func TestNormalizeAllowsNamesContainingBlockedWords(t *testing.T) {
+	names := []string{
+		"Jason", "Lucas", "Thomas", "Michelle", "Natasha", "Title", "Petit",
+		"Grass Fan", "Shell", "Hello", "Passion", "Bass Player",
+	}
+	v := testValidator()
+	for _, name := range names {
+		if _, err := v.Normalize(name); err != nil {
+			t.Errorf("Normalize(%q) = %v, want the name to be allowed", name, err)
+		}
+	}
+}
+
+func TestNormalizeBlocksDisguisedWords(t *testing.T) {
+	names := []string{
+		"badword",
+		"BadWord",
+		"B4dW0rd",
+		"bad word",
+		"b a d w o r d",
+		"b.a.d.w.o.r.d",
+		"baaaadwooord",
+		"bádwörd",
+		"ｂａｄｗｏｒｄ",
+		"𝐛𝐚𝐝𝐰𝐨𝐫𝐝",
+		"bаdword", // Cyrillic а
+		"bαdwοrd", // Greek α and ο
+		"Ass Fan",
+		"a.s.s",
+		"helllll",
+		"Hell Yeah",
+	}
+	v := testValidator()
+	for _, name := range names {
+		if _, err := v.Normalize(name); !errors.Is(err, ErrOffensiveDisplayName) {
+			t.Errorf("Normalize(%q) = %v, want %v", name, err, ErrOffensiveDisplayName)
+		}
+	}
+}
+
+func TestStretchesNeedsDoubledLettersDoubled(t *testing.T) {
+	cases := []struct {
+		candidate string
+		word      string
+		want      bool
+	}{
+		{"hell", "hell", true},
+		{"hellll", "hell", true},
+		{"hel", "hell", false},
+		{"as", "ass", false},
+		{"asss", "ass", true},
+		{"badwordx", "badword", false},
+	}
+	for _, c := range cases {
+		if got := stretches([]rune(c.candidate), []rune(c.word)); got != c.want {
+			t.Errorf("stretches(%q, %q) = %v, want %v", c.candidate, c.word, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeComposesAccents(t *testing.T) {
+	v := testValidator()
+	precomposed, err := v.Normalize("Ren\u00e9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decomposed, err := v.Normalize("Rene\u0301")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if precomposed != decomposed {
+		t.Errorf("Normalize gave %q and %q for the same name", precomposed, decomposed)
+	}
+}
+
+func TestNormalizeRejectsMisplacedAccents(t *testing.T) {
+	v := testValidator()
+	for _, name := range []string{"a-\u0301b", "ab \u0301c", "\u0301ab", "ab'\u0301"} {
+		if _, err := v.Normalize(name); !errors.Is(err, ErrInvalidDisplayName) {
+			t.Errorf("Normalize(%q) = %v, want %v", name, err, ErrInvalidDisplayName)
+		}
+	}
+}
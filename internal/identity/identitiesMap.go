@@ -38,39 +38,52 @@ func (i *IndentitiesMap) ValidateIdentity(identity *Identity) (bool, error) {
 		return false, err
 	}
 	if mappedIdentity.Secret != identity.Secret {
-		log.Printf("Spoofed identity: map %s, received %s\n", mappedIdentity.Secret, identity.Secret)
+		log.Printf("Spoofed identity: wrong secret for %s\n", identity.ID)
 		return false, ErrSpoofedIdentity
 	}
 	return true, nil
 }
 
-func (i *IndentitiesMap) UpdateIdentity(updatedIdentity Identity) bool {
-	i.Mux.RLock()
+// UpdateIdentity replaces the avatar and display name. The lookup, the secret
+// check and the write happen under one lock, so a rating stored by SetRating
+// in the meantime is never written over with an older one.
+func (i *IndentitiesMap) UpdateIdentity(updatedIdentity Identity) error {
+	i.Mux.Lock()
+	defer i.Mux.Unlock()
+
 	identity, ok := i.identities[updatedIdentity.ID]
 	if !ok {
 		log.Printf("Identity %s not found\n", updatedIdentity.ID)
-		return false
+		return ErrIdentityNotFound
 	}
-	i.Mux.RUnlock()
-
-	valid, err := i.ValidateIdentity(identity)
-	if !valid || err != nil {
-		//print the error
-		log.Printf("Error validating identity: %s\n", err)
-		return false
+	// the secret has to come from the client, not from the map
+	if identity.Secret != updatedIdentity.Secret {
+		log.Printf("Spoofed identity: wrong secret for %s\n", updatedIdentity.ID)
+		return ErrSpoofedIdentity
 	}
 
-	i.Mux.Lock()
-	newIdentity := &Identity{
+	i.identities[identity.ID] = &Identity{
 		ID:          identity.ID,
 		Secret:      identity.Secret,
 		Avatar:      updatedIdentity.Avatar,
 		DisplayName: updatedIdentity.DisplayName,
+		Rating:      identity.Rating,
 	}
-	i.identities[identity.ID] = newIdentity
-	i.Mux.Unlock()
+	return nil
+}
 
-	return true
+// SetRating stores a new rating for the identity.
+func (i *IndentitiesMap) SetRating(id string, rating int) error {
+	i.Mux.Lock()
+	defer i.Mux.Unlock()
+	identity, ok := i.identities[id]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	updated := *identity
+	updated.Rating = rating
+	i.identities[id] = &updated
+	return nil
 }
 
 func (i *IndentitiesMap) RemoveIdentity(id string) {
@@ -0,0 +1,49 @@
+package identity
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestUpdateIdentityKeepsStoredRating(t *testing.T) {
+	m := NewIdentitiesMap()
+	if err := m.AddIdentity(NewIdentity("a", "secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			m.UpdateIdentity(Identity{ID: "a", Secret: "secret", DisplayName: "Ann"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for rating := range 100 {
+			m.SetRating("a", DEFAULT_RATING+rating+1)
+		}
+	}()
+	wg.Wait()
+
+	stored, _ := m.GetIdentity("a")
+	if stored.Rating != DEFAULT_RATING+100 {
+		t.Errorf("Rating = %d, want %d, the last rating stored", stored.Rating, DEFAULT_RATING+100)
+	}
+	if stored.DisplayName != "Ann" {
+		t.Errorf("DisplayName = %q, want %q", stored.DisplayName, "Ann")
+	}
+}
+
+func TestUpdateIdentityChecksSecret(t *testing.T) {
+	m := NewIdentitiesMap()
+	m.AddIdentity(NewIdentity("a", "secret"))
+	if err := m.UpdateIdentity(Identity{ID: "a", Secret: "guess", DisplayName: "Mallory"}); !errors.Is(err, ErrSpoofedIdentity) {
+		t.Errorf("UpdateIdentity with a wrong secret = %v, want %v", err, ErrSpoofedIdentity)
+	}
+	if err := m.UpdateIdentity(Identity{ID: "b", Secret: "secret"}); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("UpdateIdentity of an unknown identity = %v, want %v", err, ErrIdentityNotFound)
+	}
+}
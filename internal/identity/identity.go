@@ -5,6 +5,9 @@ type Identity struct {
 	Secret      string `json:"secret"`
 	Avatar      string `json:"avatar"`
 	DisplayName string `json:"displayName"`
+	IsBot       bool   `json:"isBot"`
+	// Rating is kept by the server; whatever a client sends is ignored.
+	Rating int `json:"rating"`
 }
 
 func NewIdentity(id, secret string) *Identity {
@@ -13,6 +16,7 @@ func NewIdentity(id, secret string) *Identity {
 		Secret:      secret,
 		Avatar:      AVATAR_DEFAULT,
 		DisplayName: "",
+		Rating:      DEFAULT_RATING,
 	}
 }
 
@@ -20,6 +24,8 @@ type SafeIdentity struct {
 	ID          string `json:"id"`
 	Avatar      string `json:"avatar"`
 	DisplayName string `json:"displayName"`
+	IsBot       bool   `json:"isBot"`
+	Rating      int    `json:"rating,omitempty"`
 }
 
 type InitialIdentity struct {
@@ -39,5 +45,7 @@ func (i *Identity) GetSafeIdentity() *SafeIdentity {
 		ID:          i.ID,
 		Avatar:      i.Avatar,
 		DisplayName: i.DisplayName,
+		IsBot:       i.IsBot,
+		Rating:      i.Rating,
 	}
 }
@@ -1,16 +1,23 @@
 package identity
 
 import (
+	"fmt"
+
 	"github.com/Monkhai/strixos-server.git/pkg/utils"
 )
 
 type IdentityManager struct {
-	IdentitiesMap *IndentitiesMap
+	Store IdentityStore
+	Names *NameValidator
+	// Progress reports how far a player is towards the locked avatars. Nil
+	// means nobody has made any progress, so every locked avatar stays locked.
+	Progress func(id string) AvatarProgress
 }
 
-func NewIdentityManager() *IdentityManager {
+func NewIdentityManager(store IdentityStore) *IdentityManager {
 	return &IdentityManager{
-		IdentitiesMap: NewIdentitiesMap(),
+		Store: store,
+		Names: NewNameValidator(nil),
 	}
 }
 
@@ -18,6 +25,59 @@ func (i *IdentityManager) RegisterIdentity() *Identity {
 	id := utils.GenerateUniqueID()
 	secret := utils.GenerateSecret()
 	identity := NewIdentity(id, secret)
-	i.IdentitiesMap.AddIdentity(identity)
+	i.Store.AddIdentity(identity)
 	return identity
 }
+
+// UpdateIdentity checks the display name against the name rules and the
+// avatar against the catalog, and stores the update with the name
+// normalized. It returns the identity as stored.
+func (i *IdentityManager) UpdateIdentity(update Identity) (Identity, error) {
+	displayName, err := i.Names.Normalize(update.DisplayName)
+	if err != nil {
+		return Identity{}, err
+	}
+	update.DisplayName = displayName
+	update.Avatar, err = i.resolveAvatar(update.ID, update.Avatar)
+	if err != nil {
+		return Identity{}, err
+	}
+	if err := i.Store.UpdateIdentity(update); err != nil {
+		return Identity{}, err
+	}
+	if stored, err := i.Store.GetIdentity(update.ID); err == nil {
+		update.Rating = stored.Rating
+	}
+	return update, nil
+}
+
+// resolveAvatar maps the avatar a player asked for onto the catalog. No
+// avatar means the default one and an avatar the server does not know is
+// shown as AVATAR_UNKNOWN, so older clients keep working. A locked avatar
+// is refused until the player meets its requirement; the catalog tells the
+// client what that requirement is.
+func (i *IdentityManager) resolveAvatar(id, avatar string) (string, error) {
+	if avatar == "" {
+		return AVATAR_DEFAULT, nil
+	}
+	known, ok := FindAvatar(avatar)
+	if !ok {
+		return AVATAR_UNKNOWN, nil
+	}
+	if known.Requires == nil {
+		return avatar, nil
+	}
+	// an avatar that was already picked stays with the player
+	if stored, err := i.Store.GetIdentity(id); err == nil && stored.Avatar == avatar {
+		return avatar, nil
+	}
+
+	var progress AvatarProgress
+	if i.Progress != nil {
+		progress = i.Progress(id)
+	}
+	if !known.Requires.MetBy(progress) {
+		return "", fmt.Errorf("%w: %s", ErrAvatarLocked, avatar)
+	}
+	return avatar, nil
+}
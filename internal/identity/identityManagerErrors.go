@@ -6,4 +6,10 @@ var (
 	ErrSpoofedIdentity  = errors.New("spoofed identity")
 	ErrIndentityExists  = errors.New("identity already exists")
 	ErrIdentityNotFound = errors.New("identity not found")
+	ErrInvalidToken     = errors.New("invalid session token")
+	ErrTokenExpired     = errors.New("session token expired")
+	// display name rules
+	ErrInvalidDisplayName   = errors.New("invalid display name")
+	ErrOffensiveDisplayName = errors.New("display name is not allowed")
+	ErrAvatarLocked         = errors.New("avatar is locked")
 )
@@ -0,0 +1,98 @@
+package identity
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/Monkhai/strixos-server.git/pkg/utils"
+)
+
+// IdentityStore holds every identity the server knows about. IndentitiesMap
+// keeps them in memory only; FileIdentityStore also survives restarts.
+type IdentityStore interface {
+	AddIdentity(newIdentity *Identity) error
+	GetIdentity(id string) (*Identity, error)
+	ValidateIdentity(identity *Identity) (bool, error)
+	UpdateIdentity(updatedIdentity Identity) error
+	SetRating(id string, rating int) error
+	RemoveIdentity(id string)
+}
+
+// FileIdentityStore is an IndentitiesMap that writes itself to Path after
+// every change. The file holds the secrets, so it is only readable by the
+// server's user.
+type FileIdentityStore struct {
+	*IndentitiesMap
+	Path string
+	file *utils.AtomicFile
+}
+
+// NewFileIdentityStore loads the identities saved at path. A missing file is
+// an empty store.
+func NewFileIdentityStore(path string) (*FileIdentityStore, error) {
+	store := &FileIdentityStore{
+		IndentitiesMap: NewIdentitiesMap(),
+		Path:           path,
+		file:           utils.NewAtomicFile(path, 0o600),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.identities); err != nil {
+		return nil, err
+	}
+	// identities saved before ratings existed start at the default
+	for _, i := range store.identities {
+		if i.Rating == 0 {
+			i.Rating = DEFAULT_RATING
+		}
+	}
+	return store, nil
+}
+
+func (f *FileIdentityStore) AddIdentity(newIdentity *Identity) error {
+	if err := f.IndentitiesMap.AddIdentity(newIdentity); err != nil {
+		return err
+	}
+	f.save()
+	return nil
+}
+
+func (f *FileIdentityStore) UpdateIdentity(updatedIdentity Identity) error {
+	if err := f.IndentitiesMap.UpdateIdentity(updatedIdentity); err != nil {
+		return err
+	}
+	f.save()
+	return nil
+}
+
+func (f *FileIdentityStore) SetRating(id string, rating int) error {
+	if err := f.IndentitiesMap.SetRating(id, rating); err != nil {
+		return err
+	}
+	f.save()
+	return nil
+}
+
+func (f *FileIdentityStore) RemoveIdentity(id string) {
+	f.IndentitiesMap.RemoveIdentity(id)
+	f.save()
+}
+
+// save writes the whole store to Path. Errors are logged; the identities
+// are still served from memory.
+func (f *FileIdentityStore) save() {
+	err := f.file.Save(func() ([]byte, error) {
+		f.Mux.RLock()
+		defer f.Mux.RUnlock()
+		return json.Marshal(f.identities)
+	})
+	if err != nil {
+		log.Printf("error saving identities: %s\n", err)
+	}
+}
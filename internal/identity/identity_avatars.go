@@ -14,3 +14,50 @@ const (
 	AVATAR_DEFAULT     = "default"
 	AVATAR_UNKNOWN     = "unknown"
 )
+
+// AvatarRequirement is what a player has to reach before they may pick a
+// locked avatar. Every field that is set must be met.
+type AvatarRequirement struct {
+	MinWins   int `json:"minWins,omitempty"`
+	MinRating int `json:"minRating,omitempty"`
+}
+
+// AvatarProgress is how far a player has come towards the requirements.
+type AvatarProgress struct {
+	Wins   int `json:"wins"`
+	Rating int `json:"rating"`
+}
+
+func (r *AvatarRequirement) MetBy(progress AvatarProgress) bool {
+	return progress.Wins >= r.MinWins && progress.Rating >= r.MinRating
+}
+
+type Avatar struct {
+	ID       string             `json:"id"`
+	Requires *AvatarRequirement `json:"requires,omitempty"`
+}
+
+// AvatarCatalog lists every avatar a player can pick. AVATAR_UNKNOWN is not
+// in it; it is what unknown avatars are shown as.
+var AvatarCatalog = []Avatar{
+	{ID: AVATAR_DEFAULT},
+	{ID: AVATAR_BUILDER},
+	{ID: AVATAR_COOK},
+	{ID: AVATAR_FIREFIGHTER},
+	{ID: AVATAR_NURSE},
+	{ID: AVATAR_ROBBER},
+	{ID: AVATAR_SOLIDER},
+	{ID: AVATAR_COMEDIAN},
+	{ID: AVATAR_PILOT, Requires: &AvatarRequirement{MinWins: 10}},
+	{ID: AVATAR_ASTRONAUT, Requires: &AvatarRequirement{MinWins: 50}},
+	{ID: AVATAR_SCIENTIST, Requires: &AvatarRequirement{MinRating: 1600}},
+}
+
+func FindAvatar(id string) (Avatar, bool) {
+	for _, avatar := range AvatarCatalog {
+		if avatar.ID == id {
+			return avatar, true
+		}
+	}
+	return Avatar{}, false
+}
@@ -0,0 +1,28 @@
+package identity
+
+import "math"
+
+const (
+	// DEFAULT_RATING is where every new identity starts
+	DEFAULT_RATING = 1500
+	// RATING_K is the most a single game can move a rating
+	RATING_K = 32
+)
+
+// Scores of one game from a player's side, as used by Elo.
+const (
+	SCORE_LOSS = 0.0
+	SCORE_DRAW = 0.5
+	SCORE_WIN  = 1.0
+)
+
+// ExpectedScore is the score Elo expects a player rated rating to make
+// against opponent, between 0 and 1.
+func ExpectedScore(rating, opponent int) float64 {
+	return 1 / (1 + math.Pow(10, float64(opponent-rating)/400))
+}
+
+// NextRating is the player's rating after scoring score against opponent.
+func NextRating(rating, opponent int, score float64) int {
+	return rating + int(math.Round(RATING_K*(score-ExpectedScore(rating, opponent))))
+}
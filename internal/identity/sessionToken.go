@@ -0,0 +1,91 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SESSION_TOKEN_TTL = time.Hour
+	SESSION_KEY_SIZE  = 32
+)
+
+// SessionToken is handed to a client once it has authenticated. It stands in
+// for the secret on later messages and connections until ExpiresAt.
+type SessionToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TokenIssuer signs session tokens with HMAC-SHA256. A token is
+// base64(id.expiry).base64(mac), so it can be checked without any lookup.
+type TokenIssuer struct {
+	key []byte
+	TTL time.Duration
+}
+
+func NewTokenIssuer(key []byte, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{key: key, TTL: ttl}
+}
+
+// NewRandomTokenIssuer signs with a fresh random key. Its tokens stop being
+// valid when the server restarts.
+func NewRandomTokenIssuer(ttl time.Duration) *TokenIssuer {
+	key := make([]byte, SESSION_KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		panic("failed to generate session key")
+	}
+	return NewTokenIssuer(key, ttl)
+}
+
+func (t *TokenIssuer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (t *TokenIssuer) Issue(id string) SessionToken {
+	expiresAt := time.Now().Add(t.TTL).Truncate(time.Second)
+	payload := id + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	encoding := base64.RawURLEncoding
+	return SessionToken{
+		Token:     encoding.EncodeToString([]byte(payload)) + "." + encoding.EncodeToString(t.sign(payload)),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Verify checks the token's signature and expiry and returns the identity ID
+// it was issued to.
+func (t *TokenIssuer) Verify(token string) (string, error) {
+	encodedPayload, encodedMac, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+	encoding := base64.RawURLEncoding
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	mac, err := encoding.DecodeString(encodedMac)
+	if err != nil || !hmac.Equal(mac, t.sign(string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	id, expiry, found := strings.Cut(string(payload), ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() >= expiresAt {
+		return "", ErrTokenExpired
+	}
+	return id, nil
+}
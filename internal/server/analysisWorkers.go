@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+)
+
+const (
+	// ANALYSIS_WORKERS is how many games are analysed at the same time
+	ANALYSIS_WORKERS = 2
+	// ANALYSIS_QUEUE_SIZE is how many finished games may wait for a worker.
+	// Games that finish while the queue is full are not analysed.
+	ANALYSIS_QUEUE_SIZE = 64
+)
+
+// AnalysisJob is a finished game waiting to be analysed, with the players to
+// send the result to.
+type AnalysisJob struct {
+	Replay  *game.Replay
+	Players [2]*game.Player
+}
+
+// QueueAnalysis hands the game to the analysis workers without waiting. It
+// reports false when the queue is full.
+func (s *Server) QueueAnalysis(job AnalysisJob) bool {
+	select {
+	case s.Analyses <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// AnalysisWorker analyses queued games one at a time until ctx is done.
+// Players who are still connected get the analysis once it is ready; it is
+// also attached to the stored replay.
+func (s *Server) AnalysisWorker(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			{
+				return
+			}
+		case job := <-s.Analyses:
+			{
+				analysis := game.Analyse(job.Replay)
+				s.Replays.SetAnalysis(analysis)
+				log.Printf("Analysis of game %s ready, decisive move %d\n", job.Replay.GameID, analysis.DecisiveMove)
+				for _, p := range job.Players {
+					if p.IsBot() || p.Ctx.Err() != nil {
+						continue
+					}
+					p.WriteMessage(game.GameAnalysisMessage(analysis))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"log"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+)
+
+// QueueMode is a matchmade game. Once it is over the players move on to the
+// next game of their series, or get offered a rematch.
+type QueueMode struct {
+	game.BaseMode
+	Server *Server
+}
+
+func (q *QueueMode) Name() string {
+	return "queue"
+}
+
+func (q *QueueMode) RouteGameOver(g *game.Game, result game.GameResult) {
+	s := q.Server
+	if g.Series != nil {
+		seriesOver := s.AdvanceSeries(g, result, nil, func(players [2]*game.Player) {
+			s.startQueueGame(players, g.Series)
+		})
+		if !seriesOver {
+			return
+		}
+	}
+	if !g.Player1.IsConnected() || !g.Player2.IsConnected() {
+		log.Printf("Game between %s and %s ended, a player left so there is no rematch\n", g.Player1.GetID(), g.Player2.GetID())
+		return
+	}
+	log.Printf("Game between %s and %s ended, offering a rematch\n", g.Player1.GetID(), g.Player2.GetID())
+	s.RematchManager.Open([2]*game.Player{g.Player1, g.Player2}, REMATCH_WINDOW, s.HandleRematchExpired)
+}
+
+// InviteMode is a game between two friends who joined through an invite
+// link. Players learn the result together with a fresh link for the next game.
+type InviteMode struct {
+	game.BaseMode
+	Server *Server
+}
+
+func (i *InviteMode) Name() string {
+	return "invite"
+}
+
+func (i *InviteMode) OnGameOver(g *game.Game, result game.GameResult) {
+	g.WriteToSpectators(*game.GameOverMessage(g.Board, result))
+}
+
+func (i *InviteMode) RouteGameOver(g *game.Game, result game.GameResult) {
+	s := i.Server
+	log.Printf("Invite Game between %s and %s ended\n", g.Player1.GetID(), g.Player2.GetID())
+	s.InviteGameManager.RemoveGame(g.ID)
+	if g.Series == nil {
+		i.offerNextGame(g, result)
+		return
+	}
+
+	s.AdvanceSeries(g, result, func(seriesOver bool) {
+		// the last game of a series is reported with the link to a new one
+		if seriesOver {
+			i.offerNextGame(g, result)
+			return
+		}
+		g.Player1.WriteMessage(game.GameOverMessage(g.Board, result))
+		g.Player2.WriteMessage(game.GameOverMessage(g.Board, result))
+	}, func(players [2]*game.Player) {
+		next, err := game.NewGame(players, g.Board.Config, g.Rules, *s.Ctx)
+		if err != nil {
+			s.refuseGame(players[:], err)
+			return
+		}
+		next.Series = g.Series
+		next.Rater = g.Rater
+		s.StartInviteGame(next)
+	})
+}
+
+// offerNextGame tells the players how the game ended, together with the link
+// to a fresh invite game.
+func (i *InviteMode) offerNextGame(g *game.Game, result game.GameResult) {
+	s := i.Server
+	newGame := game.NewEmptyInviteGame(g.Board.Config, g.Rules, *s.Ctx)
+	if g.Series != nil {
+		newGame.Series = game.NewSeries(g.Series.BestOf)
+	}
+	s.InviteGameManager.AddGame(newGame)
+	g.Player1.WriteMessage(game.InviteGameOverMessage(g.Board, result, newGame.ID))
+	g.Player2.WriteMessage(game.InviteGameOverMessage(g.Board, result, newGame.ID))
+}
+
+// BotMode is a game against a server side bot. There is nothing to route
+// afterwards; the player can simply ask for another bot game.
+type BotMode struct {
+	game.BaseMode
+}
+
+func (BotMode) Name() string {
+	return "bot"
+}
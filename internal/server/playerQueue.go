@@ -2,29 +2,85 @@ package server
 
 import (
 	"log"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/Monkhai/strixos-server.git/internal/game"
 )
 
+const (
+	// MATCH_WINDOW_BASE is how far apart two ratings may be for players who
+	// just joined the queue
+	MATCH_WINDOW_BASE = 100
+	// the window grows by MATCH_WINDOW_GROWTH every MATCH_WINDOW_STEP a
+	// player waits, up to MATCH_WINDOW_MAX
+	MATCH_WINDOW_GROWTH = 50
+	MATCH_WINDOW_STEP   = 5 * time.Second
+	MATCH_WINDOW_MAX    = 800
+	// MATCH_WINDOW_FULL_WAIT is how long a player waits before their window
+	// reaches MATCH_WINDOW_MAX
+	MATCH_WINDOW_FULL_WAIT = (MATCH_WINDOW_MAX - MATCH_WINDOW_BASE) / MATCH_WINDOW_GROWTH * MATCH_WINDOW_STEP
+)
+
+// MatchWindow is how far from their own rating a player who has waited for
+// waited will accept an opponent.
+func MatchWindow(waited time.Duration) int {
+	window := MATCH_WINDOW_BASE + int(waited/MATCH_WINDOW_STEP)*MATCH_WINDOW_GROWTH
+	return min(window, MATCH_WINDOW_MAX)
+}
+
+// PlayerNode is a waiting player. Rating is re-read from the player every
+// time the queue is matched, so a rating that changed while they waited is
+// the one they are paired by.
 type PlayerNode struct {
-	Player *game.Player
-	Prev   *PlayerNode
-	Next   *PlayerNode
+	Player     *game.Player
+	Rating     int
+	EnqueuedAt time.Time
+	Prev       *PlayerNode
+	Next       *PlayerNode
+	// seq orders nodes that share a rating by arrival
+	seq uint64
 }
 
+// PlayerQueue keeps waiting players in arrival order, as a linked list, and
+// in rating order, as a sorted slice, so the closest rated opponent of any
+// player is a binary search away.
 type PlayerQueue struct {
-	Head *PlayerNode
-	Tail *PlayerNode
-	Map  map[string]*PlayerNode
-	Mux  *sync.RWMutex
+	Head     *PlayerNode
+	Tail     *PlayerNode
+	Map      map[string]*PlayerNode
+	ByRating []*PlayerNode
+	Mux      *sync.RWMutex
+	nextSeq  uint64
+}
+
+func compareNodes(a, b *PlayerNode) int {
+	if a.Rating != b.Rating {
+		return a.Rating - b.Rating
+	}
+	if a.seq < b.seq {
+		return -1
+	}
+	if a.seq > b.seq {
+		return 1
+	}
+	return 0
 }
 
+// Enqueue adds p at the back of the queue. A player who is already waiting
+// keeps their place, with p's connection taking over from the old one.
 func (q *PlayerQueue) Enqueue(p *game.Player) {
 	q.Mux.Lock()
 	defer q.Mux.Unlock()
 
-	node := &PlayerNode{Player: p}
+	if node, exists := q.Map[p.GetID()]; exists {
+		node.Player = p
+		return
+	}
+
+	q.nextSeq++
+	node := &PlayerNode{Player: p, Rating: p.GetRating(), EnqueuedAt: time.Now(), seq: q.nextSeq}
 
 	if q.Head == nil {
 		q.Head = node
@@ -35,7 +91,9 @@ func (q *PlayerQueue) Enqueue(p *game.Player) {
 		q.Tail = node
 	}
 
-	q.Map[p.Identity.ID] = node
+	idx, _ := slices.BinarySearchFunc(q.ByRating, node, compareNodes)
+	q.ByRating = slices.Insert(q.ByRating, idx, node)
+	q.Map[p.GetID()] = node
 }
 
 func (q *PlayerQueue) Dequeue() *game.Player {
@@ -47,15 +105,7 @@ func (q *PlayerQueue) Dequeue() *game.Player {
 	}
 
 	node := q.Head
-	q.Head = node.Next
-
-	if q.Head == nil {
-		q.Tail = nil
-	} else {
-		q.Head.Prev = nil
-	}
-
-	delete(q.Map, node.Player.Identity.ID)
+	q.unlink(node)
 	return node.Player
 }
 
@@ -63,11 +113,15 @@ func (q *PlayerQueue) RemovePlayer(p *game.Player) {
 	q.Mux.Lock()
 	defer q.Mux.Unlock()
 
-	node, exists := q.Map[p.Identity.ID]
+	node, exists := q.Map[p.GetID()]
 	if !exists {
 		return
 	}
+	q.unlink(node)
+}
 
+// unlink takes node out of both orders. The caller holds the lock.
+func (q *PlayerQueue) unlink(node *PlayerNode) {
 	if node.Prev != nil {
 		node.Prev.Next = node.Next
 	} else {
@@ -79,29 +133,157 @@ func (q *PlayerQueue) RemovePlayer(p *game.Player) {
 	} else {
 		q.Tail = node.Prev
 	}
+	node.Prev = nil
+	node.Next = nil
+
+	if idx, found := slices.BinarySearchFunc(q.ByRating, node, compareNodes); found {
+		q.ByRating = slices.Delete(q.ByRating, idx, idx+1)
+	}
+	delete(q.Map, node.Player.GetID())
+}
 
-	delete(q.Map, p.Identity.ID)
+// refreshRatings reads every waiting player's current rating and restores
+// the rating order. The caller holds the lock.
+func (q *PlayerQueue) refreshRatings() {
+	for _, node := range q.ByRating {
+		node.Rating = node.Player.GetRating()
+	}
+	slices.SortFunc(q.ByRating, compareNodes)
 }
 
-func (q *PlayerQueue) GetTwoPlayers() ([2]*game.Player, bool) {
-	q.Mux.RLock()
+func ratingGap(a, b *PlayerNode) int {
+	return max(a.Rating-b.Rating, b.Rating-a.Rating)
+}
 
-	if q.Head == nil || q.Head.Next == nil {
-		q.Mux.RUnlock()
-		return [2]*game.Player{nil, nil}, false
+// nearestOpponents walks the other waiting players outwards from node's
+// rating, closest first and the earlier arrival on a tie, until yield
+// returns false. The caller holds the lock.
+func (q *PlayerQueue) nearestOpponents(node *PlayerNode, yield func(opponent *PlayerNode) bool) {
+	idx, found := slices.BinarySearchFunc(q.ByRating, node, compareNodes)
+	if !found {
+		return
+	}
+	below, above := idx-1, idx+1
+	for {
+		var opponent *PlayerNode
+		switch {
+		case below >= 0 && above < len(q.ByRating):
+			{
+				b, a := q.ByRating[below], q.ByRating[above]
+				belowGap, aboveGap := ratingGap(node, b), ratingGap(node, a)
+				if belowGap < aboveGap || (belowGap == aboveGap && b.seq < a.seq) {
+					opponent = b
+					below--
+				} else {
+					opponent = a
+					above++
+				}
+			}
+		case below >= 0:
+			{
+				opponent = q.ByRating[below]
+				below--
+			}
+		case above < len(q.ByRating):
+			{
+				opponent = q.ByRating[above]
+				above++
+			}
+		default:
+			{
+				return
+			}
+		}
+		if opponent.Player.GetID() == node.Player.GetID() {
+			log.Println("Player tried to play with themselves")
+			continue
+		}
+		if !yield(opponent) {
+			return
+		}
 	}
-	q.Mux.RUnlock()
+}
 
-	playerOne := q.Dequeue()
-	playerTwo := q.Dequeue()
+// findOpponent returns the closest rated player node can be paired with. The
+// gap has to fit in the windows both players have earned by waiting. The
+// caller holds the lock.
+func (q *PlayerQueue) findOpponent(node *PlayerNode, now time.Time) *PlayerNode {
+	window := MatchWindow(now.Sub(node.EnqueuedAt))
+	var match *PlayerNode
+	q.nearestOpponents(node, func(opponent *PlayerNode) bool {
+		gap := ratingGap(node, opponent)
+		if gap > window {
+			return false
+		}
+		if gap <= MatchWindow(now.Sub(opponent.EnqueuedAt)) {
+			match = opponent
+			return false
+		}
+		return true
+	})
+	return match
+}
 
-	if playerOne.Identity.ID == playerTwo.Identity.ID {
-		q.Enqueue(playerOne)
-		log.Println("Player tried to play with themselves")
-		return [2]*game.Player{nil, nil}, false
+// GetMatches pairs up every waiting player it can and takes them out of the
+// queue. Players are considered in arrival order, so whoever has waited
+// longest gets the first pick: the closest rated player still waiting whose
+// gap fits in both players' windows. players[0] of each match is the one who
+// waited longer.
+func (q *PlayerQueue) GetMatches() [][2]*game.Player {
+	q.Mux.Lock()
+	defer q.Mux.Unlock()
+
+	q.refreshRatings()
+	now := time.Now()
+	var matches [][2]*game.Player
+	node := q.Head
+	for node != nil {
+		opponent := q.findOpponent(node, now)
+		if opponent == nil {
+			node = node.Next
+			continue
+		}
+
+		next := node.Next
+		if next == opponent {
+			next = opponent.Next
+		}
+		q.unlink(node)
+		q.unlink(opponent)
+		matches = append(matches, [2]*game.Player{node.Player, opponent.Player})
+		node = next
 	}
+	return matches
+}
 
-	return [2]*game.Player{playerOne, playerTwo}, true
+// GetStarvedPlayer dequeues the longest waiting player who has waited at
+// least threshold and has no human within their current window. Anyone with
+// a human in reach keeps waiting for that player's window to catch up. The
+// check and the removal happen under one lock, so the player handed out is
+// always the one who waited.
+func (q *PlayerQueue) GetStarvedPlayer(threshold time.Duration) (*game.Player, bool) {
+	q.Mux.Lock()
+	defer q.Mux.Unlock()
+
+	q.refreshRatings()
+	now := time.Now()
+	for node := q.Head; node != nil; node = node.Next {
+		waited := now.Sub(node.EnqueuedAt)
+		if waited < threshold {
+			// everyone behind node arrived later
+			break
+		}
+		inReach := false
+		q.nearestOpponents(node, func(opponent *PlayerNode) bool {
+			inReach = ratingGap(node, opponent) <= MatchWindow(waited)
+			return false
+		})
+		if !inReach {
+			q.unlink(node)
+			return node.Player, true
+		}
+	}
+	return nil, false
 }
 
 func (q *PlayerQueue) IsPlayerInQueue(id string) bool {
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+)
+
+func queuedPlayer(id string, rating int) *game.Player {
+	i := identity.NewIdentity(id, "secret")
+	i.Rating = rating
+	return game.NewPlayer(i, nil, context.Background())
+}
+
+// enqueue adds the players to q as if each had been waiting for waited.
+func enqueue(q *PlayerQueue, waited time.Duration, players ...*game.Player) {
+	for _, p := range players {
+		q.Enqueue(p)
+		q.Map[p.GetID()].EnqueuedAt = time.Now().Add(-waited)
+	}
+}
+
+func matchIDs(matches [][2]*game.Player) [][2]string {
+	var ids [][2]string
+	for _, m := range matches {
+		ids = append(ids, [2]string{m[0].GetID(), m[1].GetID()})
+	}
+	return ids
+}
+
+func TestMatchWindowGrowsToMax(t *testing.T) {
+	if got := MatchWindow(0); got != MATCH_WINDOW_BASE {
+		t.Errorf("MatchWindow(0) = %d, want %d", got, MATCH_WINDOW_BASE)
+	}
+	if got := MatchWindow(MATCH_WINDOW_FULL_WAIT - time.Second); got >= MATCH_WINDOW_MAX {
+		t.Errorf("MatchWindow just before the full wait = %d, want less than %d", got, MATCH_WINDOW_MAX)
+	}
+	if got := MatchWindow(MATCH_WINDOW_FULL_WAIT); got != MATCH_WINDOW_MAX {
+		t.Errorf("MatchWindow(MATCH_WINDOW_FULL_WAIT) = %d, want %d", got, MATCH_WINDOW_MAX)
+	}
+	if BOT_BACKFILL_WAIT < MATCH_WINDOW_FULL_WAIT {
+		t.Errorf("bots step in after %s, before the window is full at %s", BOT_BACKFILL_WAIT, MATCH_WINDOW_FULL_WAIT)
+	}
+}
+
+func TestGetMatchesPairsClosestRating(t *testing.T) {
+	q := NewPlayerQueue()
+	enqueue(q, 2*time.Second, queuedPlayer("a", 1500))
+	enqueue(q, time.Second, queuedPlayer("b", 1590), queuedPlayer("c", 1520))
+
+	got := matchIDs(q.GetMatches())
+	if len(got) != 1 || got[0] != [2]string{"a", "c"} {
+		t.Fatalf("GetMatches() = %v, want [[a c]]", got)
+	}
+	if !q.IsPlayerInQueue("b") {
+		t.Errorf("b should still be waiting")
+	}
+}
+
+func TestGetMatchesChecksBothWindows(t *testing.T) {
+	q := NewPlayerQueue()
+	// a has waited long enough for a window of 300, b has just joined
+	enqueue(q, 6*MATCH_WINDOW_STEP, queuedPlayer("a", 1500))
+	enqueue(q, 0, queuedPlayer("b", 1800))
+
+	if got := q.GetMatches(); len(got) != 0 {
+		t.Fatalf("GetMatches() = %v, want no match while b's window is %d", matchIDs(got), MATCH_WINDOW_BASE)
+	}
+
+	q.Map["b"].EnqueuedAt = time.Now().Add(-4 * MATCH_WINDOW_STEP)
+	got := matchIDs(q.GetMatches())
+	if len(got) != 1 || got[0] != [2]string{"a", "b"} {
+		t.Fatalf("GetMatches() = %v, want [[a b]] once both windows cover the gap", got)
+	}
+}
+
+func TestGetMatchesSkipsClosestOutsideItsWindow(t *testing.T) {
+	q := NewPlayerQueue()
+	enqueue(q, 6*MATCH_WINDOW_STEP, queuedPlayer("a", 1500), queuedPlayer("c", 1750))
+	// b is closer to a but has only just joined
+	enqueue(q, 0, queuedPlayer("b", 1650))
+
+	got := matchIDs(q.GetMatches())
+	if len(got) != 1 || got[0] != [2]string{"a", "c"} {
+		t.Fatalf("GetMatches() = %v, want [[a c]]", got)
+	}
+}
+
+func TestGetMatchesReadsRatingAtMatchTime(t *testing.T) {
+	q := NewPlayerQueue()
+	a, b := queuedPlayer("a", 1500), queuedPlayer("b", 1900)
+	enqueue(q, 0, a, b)
+	if got := q.GetMatches(); len(got) != 0 {
+		t.Fatalf("GetMatches() = %v, want no match 400 apart", matchIDs(got))
+	}
+
+	b.SetRating(1550)
+
+	got := matchIDs(q.GetMatches())
+	if len(got) != 1 || got[0] != [2]string{"a", "b"} {
+		t.Fatalf("GetMatches() = %v, want [[a b]] after b's rating changed", got)
+	}
+}
+
+func TestEnqueueReplacesConnectionOfWaitingPlayer(t *testing.T) {
+	q := NewPlayerQueue()
+	enqueue(q, time.Second, queuedPlayer("a", 1500))
+	reconnected := queuedPlayer("a", 1500)
+	q.Enqueue(reconnected)
+	enqueue(q, 0, queuedPlayer("b", 1500))
+
+	matches := q.GetMatches()
+	if len(matches) != 1 {
+		t.Fatalf("GetMatches() = %v, want one match", matchIDs(matches))
+	}
+	if matches[0][0] != reconnected {
+		t.Errorf("matched the stale connection of a, want the reconnected one")
+	}
+}
+
+func TestGetStarvedPlayerUsesThreshold(t *testing.T) {
+	threshold := 10 * time.Second
+	q := NewPlayerQueue()
+	enqueue(q, threshold-time.Second, queuedPlayer("a", 1500))
+	if _, starved := q.GetStarvedPlayer(threshold); starved {
+		t.Fatalf("a was handed to a bot before waiting %s", threshold)
+	}
+
+	q.Map["a"].EnqueuedAt = time.Now().Add(-threshold)
+	p, starved := q.GetStarvedPlayer(threshold)
+	if !starved || p.GetID() != "a" {
+		t.Fatalf("GetStarvedPlayer() = %v, %v, want a", p, starved)
+	}
+	if q.IsPlayerInQueue("a") {
+		t.Errorf("a is still queued after being handed to a bot")
+	}
+}
+
+func TestGetStarvedPlayerKeepsPlayersWithHumanInReach(t *testing.T) {
+	q := NewPlayerQueue()
+	enqueue(q, BOT_BACKFILL_WAIT, queuedPlayer("a", 1500))
+	// b is within a's full window but has only just joined
+	enqueue(q, 0, queuedPlayer("b", 2000))
+
+	if p, starved := q.GetStarvedPlayer(BOT_BACKFILL_WAIT); starved {
+		t.Fatalf("GetStarvedPlayer() = %s, want a to keep waiting for b", p.GetID())
+	}
+
+	q.RemovePlayer(q.Map["b"].Player)
+	enqueue(q, 0, queuedPlayer("c", 1500+MATCH_WINDOW_MAX+1))
+	if p, starved := q.GetStarvedPlayer(BOT_BACKFILL_WAIT); !starved || p.GetID() != "a" {
+		t.Fatalf("GetStarvedPlayer() = %v, %v, want a with nobody in reach", p, starved)
+	}
+}
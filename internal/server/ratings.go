@@ -0,0 +1,67 @@
+package server
+
+import (
+	"log"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+)
+
+// EloRater rates games with Elo and keeps the ratings on the players'
+// stored identities.
+type EloRater struct {
+	Server *Server
+}
+
+// rating reads the stored rating, which is the one that counts; the copy on
+// the player may be out of date.
+func (e *EloRater) rating(p *game.Player) int {
+	stored, err := e.Server.IdentityManager.Store.GetIdentity(p.GetID())
+	if err != nil {
+		return p.GetRating()
+	}
+	return stored.Rating
+}
+
+func (e *EloRater) Stakes(g *game.Game) map[string]game.RatingStakes {
+	ratings := [2]int{e.rating(g.Player1), e.rating(g.Player2)}
+	stakes := make(map[string]game.RatingStakes)
+	for idx, p := range [2]*game.Player{g.Player1, g.Player2} {
+		rating, opponent := ratings[idx], ratings[1-idx]
+		stakes[p.GetID()] = game.RatingStakes{
+			Rating: rating,
+			Win:    identity.NextRating(rating, opponent, identity.SCORE_WIN) - rating,
+			Draw:   identity.NextRating(rating, opponent, identity.SCORE_DRAW) - rating,
+			Loss:   identity.NextRating(rating, opponent, identity.SCORE_LOSS) - rating,
+		}
+	}
+	return stakes
+}
+
+// Rate moves both ratings by the result. Leaving and disconnecting reach
+// here as a win for the other player, so they cost the same as a loss.
+func (e *EloRater) Rate(g *game.Game, result game.GameResult) map[string]game.RatingChange {
+	players := [2]*game.Player{g.Player1, g.Player2}
+	ratings := [2]int{e.rating(g.Player1), e.rating(g.Player2)}
+	changes := make(map[string]game.RatingChange)
+	for idx, p := range players {
+		score := identity.SCORE_DRAW
+		if !result.IsDraw() {
+			score = identity.SCORE_LOSS
+			if result.Winner.GetID() == p.GetID() {
+				score = identity.SCORE_WIN
+			}
+		}
+		before := ratings[idx]
+		after := identity.NextRating(before, ratings[1-idx], score)
+		changes[p.GetID()] = game.RatingChange{Before: before, After: after, Delta: after - before}
+
+		if err := e.Server.IdentityManager.Store.SetRating(p.GetID(), after); err != nil {
+			log.Printf("error saving the rating of player %s: %s\n", p.GetID(), err)
+			continue
+		}
+		p.SetRating(after)
+	}
+	log.Printf("Rated game %s: %+v\n", g.ID, changes)
+	return changes
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+const REMATCH_WINDOW = 30 * time.Second
+
+// RematchOffer is open between the two players of a finished game until both
+// accept, one of them declines or leaves, or the window runs out.
+type RematchOffer struct {
+	Players  [2]*game.Player
+	Accepted map[string]bool
+	Timer    *time.Timer
+}
+
+func (o *RematchOffer) Opponent(p *game.Player) *game.Player {
+	if o.Players[0].GetID() == p.GetID() {
+		return o.Players[1]
+	}
+	return o.Players[0]
+}
+
+type RematchManager struct {
+	Offers map[string]*RematchOffer
+	Mux    *sync.Mutex
+}
+
+func NewRematchManager() *RematchManager {
+	return &RematchManager{
+		Offers: make(map[string]*RematchOffer),
+		Mux:    &sync.Mutex{},
+	}
+}
+
+func (r *RematchManager) Open(players [2]*game.Player, window time.Duration, onExpire func(*RematchOffer)) {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	offer := &RematchOffer{
+		Players:  players,
+		Accepted: make(map[string]bool),
+	}
+	offer.Timer = time.AfterFunc(window, func() {
+		if r.remove(offer) {
+			onExpire(offer)
+		}
+	})
+	for _, p := range players {
+		r.Offers[p.GetID()] = offer
+	}
+}
+
+// Accept records that p wants a rematch. ready is true once both players
+// accepted, in which case the offer is closed.
+func (r *RematchManager) Accept(p *game.Player) (offer *RematchOffer, ready bool, found bool) {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	offer, found = r.Offers[p.GetID()]
+	if !found {
+		return nil, false, false
+	}
+	offer.Accepted[p.GetID()] = true
+	if len(offer.Accepted) < 2 {
+		return offer, false, true
+	}
+
+	offer.Timer.Stop()
+	for _, player := range offer.Players {
+		delete(r.Offers, player.GetID())
+	}
+	return offer, true, true
+}
+
+// Cancel closes the offer p is part of, if there is one.
+func (r *RematchManager) Cancel(p *game.Player) (*RematchOffer, bool) {
+	r.Mux.Lock()
+	offer, found := r.Offers[p.GetID()]
+	r.Mux.Unlock()
+	if !found || !r.remove(offer) {
+		return nil, false
+	}
+	offer.Timer.Stop()
+	return offer, true
+}
+
+func (r *RematchManager) remove(offer *RematchOffer) bool {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	removed := false
+	for _, p := range offer.Players {
+		if r.Offers[p.GetID()] == offer {
+			delete(r.Offers, p.GetID())
+			removed = true
+		}
+	}
+	return removed
+}
+
+func (s *Server) HandleAcceptRematch(p *game.Player) {
+	offer, ready, found := s.RematchManager.Accept(p)
+	if !found {
+		log.Printf("Player %s asked for a rematch but there is no open offer\n", p.GetID())
+		p.WriteMessage(shared.TypedErrorMessage(shared.NoRematchErrorCode, "no rematch available"))
+		return
+	}
+
+	if !ready {
+		log.Printf("Player %s asked for a rematch\n", p.GetID())
+		offer.Opponent(p).WriteMessage(shared.RematchRequestedMessage(p.GetSafeIdentity()))
+		return
+	}
+
+	// the offer stays open while players do other things; whoever is already
+	// in another game or gone cannot be pulled into this one
+	for _, player := range offer.Players {
+		reason := ""
+		switch {
+		case !player.IsConnected():
+			{
+				reason = shared.REMATCH_REASON_LEFT
+			}
+		case player.GetIsInGame():
+			{
+				reason = shared.REMATCH_REASON_IN_GAME
+			}
+		}
+		if reason != "" {
+			log.Printf("Rematch for player %s refused: %s\n", player.GetID(), reason)
+			offer.Opponent(player).WriteMessage(shared.RematchDeclinedMessage(reason))
+			return
+		}
+	}
+
+	// swap colors so the player who moved second now moves first
+	s.StartGame([2]*game.Player{offer.Players[1], offer.Players[0]})
+}
+
+func (s *Server) HandleDeclineRematch(p *game.Player, reason string) {
+	offer, found := s.RematchManager.Cancel(p)
+	if !found {
+		return
+	}
+	log.Printf("Player %s declined a rematch: %s\n", p.GetID(), reason)
+	offer.Opponent(p).WriteMessage(shared.RematchDeclinedMessage(reason))
+}
+
+func (s *Server) HandleRematchExpired(offer *RematchOffer) {
+	log.Printf("Rematch between %s and %s expired\n", offer.Players[0].GetID(), offer.Players[1].GetID())
+	for _, p := range offer.Players {
+		p.WriteMessage(shared.RematchExpiredMessage())
+	}
+}
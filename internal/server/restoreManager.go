@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+const (
+	SNAPSHOT_DIR      = "snapshots"
+	SNAPSHOT_INTERVAL = 10 * time.Second
+	RESTORE_WAIT      = 2 * time.Minute
+)
+
+// PendingGame is a game brought back from a snapshot that is waiting for its
+// players to reconnect. Bots do not need to reconnect, so only the human
+// players are waited for.
+type PendingGame struct {
+	Snapshot game.GameSnapshot
+	Waiting  map[string]bool
+	Players  map[string]*game.Player
+	Timer    *time.Timer
+}
+
+type RestoreManager struct {
+	Games map[string]*PendingGame
+	Mux   *sync.Mutex
+}
+
+func NewRestoreManager() *RestoreManager {
+	return &RestoreManager{
+		Games: make(map[string]*PendingGame),
+		Mux:   &sync.Mutex{},
+	}
+}
+
+func (r *RestoreManager) Add(snapshot game.GameSnapshot, wait time.Duration, onExpire func(*PendingGame)) {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	pending := &PendingGame{
+		Snapshot: snapshot,
+		Waiting:  make(map[string]bool),
+		Players:  make(map[string]*game.Player),
+	}
+	for _, i := range snapshot.Players {
+		if !i.IsBot {
+			pending.Waiting[i.ID] = true
+		}
+	}
+	pending.Timer = time.AfterFunc(wait, func() {
+		if r.remove(pending) {
+			onExpire(pending)
+		}
+	})
+	for id := range pending.Waiting {
+		r.Games[id] = pending
+	}
+}
+
+// Claim attaches p to the restored game they were playing, replacing any
+// earlier connection of theirs. ready is true once every human player is
+// back, in which case the game is handed over and no longer pending.
+func (r *RestoreManager) Claim(p *game.Player) (pending *PendingGame, ready bool, found bool) {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	pending, found = r.Games[p.GetID()]
+	if !found {
+		return nil, false, false
+	}
+	pending.Players[p.GetID()] = p
+	if len(pending.Players) < len(pending.Waiting) {
+		return pending, false, true
+	}
+
+	pending.Timer.Stop()
+	for id := range pending.Waiting {
+		delete(r.Games, id)
+	}
+	return pending, true, true
+}
+
+// Snapshots returns the snapshots of every game still waiting, so they are
+// not lost if the server goes down again before the players come back.
+func (r *RestoreManager) Snapshots() []game.GameSnapshot {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	seen := make(map[string]bool)
+	var snapshots []game.GameSnapshot
+	for _, pending := range r.Games {
+		if seen[pending.Snapshot.ID] {
+			continue
+		}
+		seen[pending.Snapshot.ID] = true
+		snapshots = append(snapshots, pending.Snapshot)
+	}
+	return snapshots
+}
+
+func (r *RestoreManager) remove(pending *PendingGame) bool {
+	r.Mux.Lock()
+	defer r.Mux.Unlock()
+
+	removed := false
+	for id := range pending.Waiting {
+		if r.Games[id] == pending {
+			delete(r.Games, id)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// RestoreSnapshots loads the games that were live when the server last went
+// down. Their identities are put back so the players can authenticate again,
+// and each game waits up to RestoreWait for them.
+func (s *Server) RestoreSnapshots() {
+	if s.Snapshots == nil {
+		return
+	}
+	snapshots, err := s.Snapshots.LoadAll()
+	if err != nil {
+		log.Printf("error loading snapshots: %s\n", err)
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		for _, i := range snapshot.Players {
+			if i.IsBot {
+				continue
+			}
+			restored := i
+			err := s.IdentityManager.Store.AddIdentity(&restored)
+			if err != nil && !errors.Is(err, identity.ErrIndentityExists) {
+				log.Printf("error restoring identity %s: %s\n", i.ID, err)
+			}
+		}
+		s.RestoreManager.Add(snapshot, s.RestoreWait, s.HandleRestoreExpired)
+		log.Printf("Restored game %s, waiting for players to reconnect\n", snapshot.ID)
+	}
+}
+
+// ResumeRestoredGame is called when p authenticates. If p was playing a
+// restored game, they wait for the other player, or the game starts again
+// once everyone is back. It reports whether p belongs to a restored game.
+func (s *Server) ResumeRestoredGame(p *game.Player) bool {
+	pending, ready, found := s.RestoreManager.Claim(p)
+	if !found {
+		return false
+	}
+	p.SetIsInGame(true)
+	if !ready {
+		log.Printf("Player %s is back, waiting for the rest of game %s\n", p.GetID(), pending.Snapshot.ID)
+		p.WriteMessage(shared.GameWaitingMessage())
+		return true
+	}
+
+	var players [2]*game.Player
+	for idx, i := range pending.Snapshot.Players {
+		if i.IsBot {
+			bot := game.NewBotPlayer(pending.Snapshot.BotDifficulty, *s.Ctx)
+			restored := i
+			bot.UpdateIdentity(restored)
+			players[idx] = bot
+			continue
+		}
+		players[idx] = pending.Players[i.ID]
+	}
+
+	g, err := game.RestoreGame(pending.Snapshot, players, *s.Ctx)
+	if err != nil {
+		log.Printf("error restoring game %s: %s\n", pending.Snapshot.ID, err)
+		s.HandleRestoreExpired(pending)
+		return true
+	}
+
+	if pending.Snapshot.Rated {
+		g.Rater = &EloRater{Server: s}
+	}
+	log.Printf("Resuming game %s\n", g.ID)
+	for _, player := range players {
+		if player.IsBot() {
+			s.Wg.Add(1)
+			go player.Bot.Play(g, player, s.Wg)
+		}
+	}
+	s.RunGame(g, s.modeByName(pending.Snapshot.Mode))
+	return true
+}
+
+// HandleRestoreExpired gives up on a restored game. Whoever did come back is
+// told the game is closed and is free to play again.
+func (s *Server) HandleRestoreExpired(pending *PendingGame) {
+	log.Printf("Players of restored game %s did not come back in time\n", pending.Snapshot.ID)
+	for _, p := range pending.Players {
+		p.SetIsInGame(false)
+		p.WriteMessage(shared.GameClosedMessage())
+	}
+}
+
+func (s *Server) modeByName(name string) game.GameMode {
+	switch name {
+	case (&QueueMode{}).Name():
+		return &QueueMode{Server: s}
+	case (&InviteMode{}).Name():
+		return &InviteMode{Server: s}
+	case BotMode{}.Name():
+		return BotMode{}
+	default:
+		return game.BaseMode{}
+	}
+}
+
+// SaveSnapshots writes every live game, and every restored game still
+// waiting for its players, to disk.
+func (s *Server) SaveSnapshots() {
+	// once the server is shutting down its games are being cancelled, and
+	// saving now would drop them from disk
+	if s.Snapshots == nil || (*s.Ctx).Err() != nil {
+		return
+	}
+	snapshots := s.RestoreManager.Snapshots()
+	for _, g := range s.ActiveGames.Games() {
+		if g.Ctx.Err() != nil || g.GetActivePlayer() == nil {
+			continue
+		}
+		snapshots = append(snapshots, g.Snapshot())
+	}
+	if err := s.Snapshots.SaveAll(snapshots); err != nil {
+		log.Printf("error saving snapshots: %s\n", err)
+	}
+}
+
+func (s *Server) SnapshotLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(s.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			{
+				// the final snapshot is taken before the server cancels its games
+				log.Println("SNAPSHOT LOOP DONE")
+				return
+			}
+		case <-ticker.C:
+			{
+				s.SaveSnapshots()
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"sync"
@@ -14,103 +15,314 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// BOT_BACKFILL_WAIT defaults to the time it takes a queue window to reach
+	// its maximum, so by default a bot only steps in once no human can be found
+	BOT_BACKFILL_WAIT = MATCH_WINDOW_FULL_WAIT
+	RECONNECT_GRACE   = 30 * time.Second
+)
+
 type Server struct {
-	Queue             *PlayerQueue
-	Mux               *sync.RWMutex
-	Ctx               *context.Context
-	Wg                *sync.WaitGroup
-	IdentityManager   *identity.IdentityManager
-	InviteGameManager *game.InviteGameManager
+	Queue       *PlayerQueue
+	BoardConfig game.BoardConfig
+	Rules       game.RuleSet
+	QueueBestOf int
+	// BotBackfillAfter is how long a lone player waits in the queue before
+	// being matched against a bot. Zero disables backfill.
+	BotBackfillAfter      time.Duration
+	BotBackfillDifficulty game.BotDifficulty
+	Mux                   *sync.RWMutex
+	Ctx                   *context.Context
+	Wg                    *sync.WaitGroup
+	IdentityManager       *identity.IdentityManager
+	InviteGameManager     *game.GameManager
+	ActiveGames           *game.GameManager
+	Replays               *game.ReplayStore
+	RematchManager        *RematchManager
+	// Snapshots stores live games across restarts. Nil disables snapshots.
+	Snapshots        *game.SnapshotStore
+	SnapshotInterval time.Duration
+	RestoreWait      time.Duration
+	RestoreManager   *RestoreManager
+	// ReconnectGrace is how long a player who drops out of a game has to
+	// come back on a new connection.
+	ReconnectGrace time.Duration
+	Sessions       *identity.TokenIssuer
+	Profiles       *game.ProfileStore
+	// Analyses holds finished games for the AnalysisWorkers
+	Analyses chan AnalysisJob
 }
 
 func NewServer(ctx *context.Context, wg *sync.WaitGroup) *Server {
-	return &Server{
-		Ctx:               ctx,
-		Wg:                wg,
-		Queue:             NewPlayerQueue(),
-		Mux:               &sync.RWMutex{},
-		IdentityManager:   identity.NewIdentityManager(),
-		InviteGameManager: game.NewInviteGameManager(),
+	s := &Server{
+		Ctx:                   ctx,
+		Wg:                    wg,
+		Queue:                 NewPlayerQueue(),
+		BoardConfig:           game.DefaultBoardConfig,
+		Rules:                 game.DefaultRuleSet,
+		QueueBestOf:           1,
+		BotBackfillAfter:      BOT_BACKFILL_WAIT,
+		BotBackfillDifficulty: game.BOT_MEDIUM,
+		Mux:                   &sync.RWMutex{},
+		IdentityManager:       identity.NewIdentityManager(identity.NewIdentitiesMap()),
+		InviteGameManager:     game.NewGameManager(),
+		ActiveGames:           game.NewGameManager(),
+		Replays:               game.NewReplayStore(game.MAX_STORED_REPLAYS),
+		RematchManager:        NewRematchManager(),
+		Snapshots:             game.NewSnapshotStore(SNAPSHOT_DIR),
+		SnapshotInterval:      SNAPSHOT_INTERVAL,
+		RestoreWait:           RESTORE_WAIT,
+		RestoreManager:        NewRestoreManager(),
+		ReconnectGrace:        RECONNECT_GRACE,
+		Sessions:              identity.NewRandomTokenIssuer(identity.SESSION_TOKEN_TTL),
+		Profiles:              game.NewProfileStore(),
+		Analyses:              make(chan AnalysisJob, ANALYSIS_QUEUE_SIZE),
 	}
+	s.IdentityManager.Progress = s.AvatarProgress
+	return s
 }
 
+// WebSocketHandler upgrades the connection. Returning players can send a
+// session token or their id and secret with the upgrade request (see
+// UpgradeIdentity) and skip the register handshake; bad credentials are
+// refused before the upgrade.
 func (s *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	i, authenticated, err := s.UpgradeIdentity(r)
+	if err != nil {
+		log.Printf("Refused websocket upgrade: %s\n", err)
+		// the same answer for every failure, so an unknown identity cannot be
+		// told apart from a wrong secret or a bad token
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	upgrader := websocket.Upgrader{}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("error creating the ws connection: %s", err)
+		return
+	}
+	if authenticated {
+		s.AddAuthenticatedPlayer(conn, i, s.Wg)
+		return
 	}
 	s.AddPlayer(conn, s.Wg)
 }
 
+// ReplayHandler serves a finished game as JSON: GET /replay?id=<gameID>
+func (s *Server) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	replay, found := s.Replays.GetReplay(r.URL.Query().Get("id"))
+	if !found {
+		http.Error(w, "replay not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(replay); err != nil {
+		log.Printf("error writing replay %s: %s", replay.GameID, err)
+	}
+}
+
+// ProfileHandler serves a player's public profile: GET /profile?id=<playerID>
+func (s *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	profile, found := s.Profile(r.URL.Query().Get("id"))
+	if !found {
+		http.Error(w, "profile not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		log.Printf("error writing profile %s: %s", profile.Identity.ID, err)
+	}
+}
+
+// AvatarsHandler serves the avatar catalog: GET /avatars
+func (s *Server) AvatarsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(identity.AvatarCatalog); err != nil {
+		log.Printf("error writing avatar catalog: %s", err)
+	}
+}
+
 func (s *Server) AddPlayer(conn *websocket.Conn, wg *sync.WaitGroup) {
 	i := s.IdentityManager.RegisterIdentity()
 	p := game.NewPlayer(i, conn, *s.Ctx)
-	log.Printf("New connection with player %s\n", p.Identity.ID)
+	log.Printf("New connection with player %s\n", p.GetID())
 
 	p.WriteMessage(shared.InitialIdentityMessage(identity.InitialIdentity{
 		ID:     i.ID,
 		Secret: i.Secret,
-	}))
-	log.Println("Identity sent to player", p.Identity.ID)
+	}, identity.AvatarCatalog))
+	log.Println("Identity sent to player", p.GetID())
 
-	//read auth message
-	//TODO: wrap in a for loop in case the message is wrong
-	_, msg, err := conn.ReadMessage()
-	if err != nil {
-		defer s.IdentityManager.IdentitiesMap.RemoveIdentity(p.Identity.ID)
-		//error is 1000
-		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
-			log.Println("Connection disconnected before finished auth")
+	// the identity handed out above is dropped unless the player takes it;
+	// returning players authenticate with the one they already have
+	keepRegistered := false
+	defer func() {
+		if !keepRegistered {
+			s.IdentityManager.Store.RemoveIdentity(i.ID)
+		}
+	}()
+
+	//read auth messages until one is accepted; a rejected display name
+	//can be fixed and sent again
+	var updated identity.Identity
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			//error is 1000
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				log.Println("Connection disconnected before finished auth")
+				return
+			}
+			log.Printf("error reading message from player %s: %s", p.GetID(), err)
+			return
+		}
+		var m game.UpdateIdentityMessage
+		err = json.Unmarshal(msg, &m)
+		if err != nil {
+			log.Printf("error unmarshalling message from player %s: %s", p.GetID(), err)
 			return
 		}
-		log.Printf("error reading message from player %s: %s", p.Identity.ID, err)
-		return
-	}
-	var m game.UpdateIdentityMessage
-	err = json.Unmarshal(msg, &m)
-	if err != nil {
-		log.Printf("error unmarshalling message from player %s: %s", p.Identity.ID, err)
-		return
-	}
 
-	if m.Type != shared.IdentityUpdateMessageType {
-		log.Printf("Player %s sent an unkown message type: %s\n", p.Identity.ID, m.Type)
-		return
-	}
+		if m.Type != shared.IdentityUpdateMessageType {
+			log.Printf("Player %s sent an unkown message type: %s\n", p.GetID(), m.Type)
+			return
+		}
 
-	valid := s.IdentityManager.IdentitiesMap.UpdateIdentity(m.Content.Identity)
-	if !valid {
-		log.Printf("Player %s failed to update during initial auth\n", p.Identity.ID)
-		return
+		requested, err := s.handshakeIdentity(m)
+		if err != nil {
+			log.Printf("Player %s sent an invalid session token: %s\n", p.GetID(), err)
+			return
+		}
+		updated, err = s.IdentityManager.UpdateIdentity(requested)
+		if canRetryIdentity(err) {
+			log.Printf("Player %s picked an identity that was refused: %s\n", p.GetID(), err)
+			p.WriteMessage(shared.TypedErrorMessage(identityErrorCode(err), err.Error()))
+			continue
+		}
+		if err != nil {
+			log.Printf("Player %s failed to update during initial auth: %s\n", p.GetID(), err)
+			return
+		}
+		break
 	}
+	keepRegistered = updated.ID == i.ID
 
-	p.UpdateIdentity(m.Content.Identity)
-	p.WriteMessage(shared.RegistedMesage(p.Identity))
+	p.UpdateIdentity(updated)
+	log.Println("Identity updated for player", p.GetID())
+	s.startPlayer(p, wg)
+}
+
+// AddAuthenticatedPlayer adds a player whose identity was already checked
+// during the upgrade. They go straight to registered.
+func (s *Server) AddAuthenticatedPlayer(conn *websocket.Conn, i *identity.Identity, wg *sync.WaitGroup) {
+	p := game.NewPlayer(i, conn, *s.Ctx)
+	log.Printf("Player %s authenticated at upgrade\n", p.GetID())
+	s.startPlayer(p, wg)
+}
 
-	log.Println("Identity updated for player", p.Identity.ID)
+// startPlayer confirms the registration, starts listening to p and puts
+// them back into any game they were playing.
+func (s *Server) startPlayer(p *game.Player, wg *sync.WaitGroup) {
+	p.WriteMessage(shared.RegistedMesage(p.GetSafeIdentity(), s.Sessions.Issue(p.GetID()), identity.AvatarCatalog))
 
 	wg.Add(2)
 	go s.ListenToPlayerMessages(p, wg)
-	go p.Listen(wg, s.IdentityManager.IdentitiesMap.ValidateIdentity)
+	go p.Listen(wg, s.AuthenticateMessage)
+	if !s.ResumeRestoredGame(p) {
+		s.ReattachToGame(p)
+	}
+}
+
+// ReattachToGame hands p to the live game their identity is playing in, if
+// any, replacing the connection they dropped. It reports whether p was
+// reattached.
+func (s *Server) ReattachToGame(p *game.Player) bool {
+	for _, g := range s.ActiveGames.Games() {
+		if !g.HasPlayer(p.GetID()) {
+			continue
+		}
+		if g.Reconnect(p) {
+			log.Printf("Player %s reattached to game %s\n", p.GetID(), g.ID)
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Server) HandleRequestGame(p *game.Player) {
-	log.Printf("Player %s disconnected\n", p.Identity.ID)
+	log.Printf("Player %s requested a game\n", p.GetID())
+	s.StopSpectating(p)
+	s.HandleDeclineRematch(p, shared.REMATCH_REASON_LEFT)
 	p.WriteMessage(shared.GameWaitingMessage())
 	s.Queue.Enqueue(p)
 }
 
+func (s *Server) HandleSpectateRequest(p *game.Player, gameID string) {
+	g, found := s.ActiveGames.GetGame(gameID)
+	if !found || g.Ctx.Err() != nil || g.GetActivePlayer() == nil {
+		log.Printf("Player %s asked to spectate game %s but it is not live\n", p.GetID(), gameID)
+		p.WriteMessage(shared.TypedErrorMessage(shared.GameNotFoundErrorCode, "game not found"))
+		return
+	}
+	if p.GetIsInGame() {
+		log.Printf("Player %s asked to spectate while in a game\n", p.GetID())
+		p.WriteMessage(shared.TypedErrorMessage(shared.AlreadyInGameErrorCode, "already in a game"))
+		return
+	}
+
+	s.StopSpectating(p)
+	s.Queue.RemovePlayer(p)
+	count := g.AddSpectator(p)
+	log.Printf("Player %s is spectating game %s (%d spectators)\n", p.GetID(), g.ID, count)
+	p.WriteMessage(g.SpectatorStartMessage())
+}
+
+// StopSpectating detaches p from the game it is watching, if any.
+func (s *Server) StopSpectating(p *game.Player) {
+	gameID := p.GetSpectatingGameID()
+	if gameID == "" {
+		return
+	}
+	if g, found := s.ActiveGames.GetGame(gameID); found {
+		g.RemoveSpectator(p)
+	} else {
+		p.SetSpectating("")
+	}
+	log.Printf("Player %s stopped spectating game %s\n", p.GetID(), gameID)
+}
+
 func (s *Server) HandleLeaveQueueRequest(p *game.Player) {
-	log.Printf("Player %s left the queue\n", p.Identity.ID)
+	log.Printf("Player %s left the queue\n", p.GetID())
 	p.WriteMessage(shared.RemovedFromQueueMessage)
 	s.Queue.RemovePlayer(p)
 }
 
-func (s *Server) HandleLeaveGameRequest(requester, otherPlayer *game.Player) {
-	log.Printf("Player %s left the game\n", requester.Identity.ID)
-	requester.WriteMessage(shared.RemovedFromGameMessage())
-	otherPlayer.WriteMessage(shared.GameClosedMessage())
+// HandleLeaveGameRequest closes a game one player walked away from. In a
+// rated game both players are told how their ratings moved.
+func (s *Server) HandleLeaveGameRequest(requester, otherPlayer *game.Player, result game.GameResult) {
+	log.Printf("Player %s left the game\n", requester.GetID())
+	removed := shared.RemovedFromGameMessage()
+	closed := shared.GameClosedMessage()
+	if result.RatingChanges != nil {
+		removed.Content = map[string]any{"ratingChanges": result.RatingChanges}
+		closed.Content = map[string]any{"ratingChanges": result.RatingChanges}
+	}
+	requester.WriteMessage(removed)
+	otherPlayer.WriteMessage(closed)
 	requester.SetIsInGame(false)
 	otherPlayer.SetIsInGame(false)
 }
@@ -128,13 +340,14 @@ func (s *Server) QueueLoop(ctx context.Context, wg *sync.WaitGroup) {
 			}
 		default:
 			{
-				players, hasPlayers := s.Queue.GetTwoPlayers()
-				if hasPlayers {
-					log.Println("Starting a game between", players[0].Identity.ID, "and", players[1].Identity.ID)
-					game := game.NewGame(players, ctx)
-					wg.Add(2)
-					go game.GameLoop(wg)
-					go s.ListenToGameMessages(game, wg)
+				for _, players := range s.Queue.GetMatches() {
+					s.StartGame(players)
+				}
+				if s.BotBackfillAfter > 0 {
+					if p, starved := s.Queue.GetStarvedPlayer(s.BotBackfillAfter); starved {
+						log.Printf("Player %s waited too long, matching against a bot\n", p.GetID())
+						s.StartBotGame(p, s.BotBackfillDifficulty)
+					}
 				}
 				time.Sleep(5 * time.Second)
 			}
@@ -142,57 +355,205 @@ func (s *Server) QueueLoop(ctx context.Context, wg *sync.WaitGroup) {
 	}
 }
 
+// StartGame starts a matchmade game between two players. players[0] plays x
+// and moves first. When the server is configured for series play, the game
+// opens a new series.
+func (s *Server) StartGame(players [2]*game.Player) {
+	var series *game.Series
+	if s.QueueBestOf > 1 {
+		series = game.NewSeries(s.QueueBestOf)
+	}
+	s.startQueueGame(players, series)
+}
+
+func (s *Server) startQueueGame(players [2]*game.Player, series *game.Series) {
+	log.Println("Starting a game between", players[0].GetID(), "and", players[1].GetID())
+	g, err := game.NewGame(players, s.BoardConfig, s.Rules, *s.Ctx)
+	if err != nil {
+		s.refuseGame(players[:], err)
+		return
+	}
+	g.Series = series
+	g.Rater = &EloRater{Server: s}
+	s.RunGame(g, &QueueMode{Server: s})
+}
+
+// StartBotGame starts a game between p and a server side bot. The human
+// always moves first.
+func (s *Server) StartBotGame(p *game.Player, difficulty game.BotDifficulty) {
+	bot := game.NewBotPlayer(difficulty, *s.Ctx)
+	log.Printf("Starting a %s bot game for player %s\n", difficulty, p.GetID())
+	g, err := game.NewGame([2]*game.Player{p, bot}, s.BoardConfig, s.Rules, *s.Ctx)
+	if err != nil {
+		s.refuseGame([]*game.Player{p}, err)
+		return
+	}
+	s.Wg.Add(1)
+	go bot.Bot.Play(g, bot, s.Wg)
+	s.RunGame(g, BotMode{})
+}
+
+// refuseGame tells the players a game could not be started because its board
+// or rules are invalid.
+func (s *Server) refuseGame(players []*game.Player, err error) {
+	log.Printf("error starting a game: %s\n", err)
+	code := shared.InvalidRuleSetErrorCode
+	if errors.Is(err, game.ErrInvalidBoardConfig) {
+		code = shared.InvalidBoardConfigErrorCode
+	}
+	for _, p := range players {
+		p.WriteMessage(shared.TypedErrorMessage(code, err.Error()))
+	}
+}
+
+func (s *Server) StartInviteGame(g *game.Game) {
+	s.RunGame(g, &InviteMode{Server: s})
+}
+
+// RunGame registers g as live and starts its loop under the given mode.
+// Players who were watching another game, say while a rematch offer was
+// open, stop watching it.
+func (s *Server) RunGame(g *game.Game, mode game.GameMode) {
+	s.StopSpectating(g.Player1)
+	s.StopSpectating(g.Player2)
+	g.Mode = mode
+	g.ReconnectGrace = s.ReconnectGrace
+	s.ActiveGames.AddGame(g)
+	s.Wg.Add(2)
+	go g.Run(s.Wg)
+	go s.ListenToGameMessages(g, s.Wg)
+}
+
+// AdvanceSeries records the result of a series game. If the series goes on,
+// the players are told the score and the next game is started with the other
+// player moving first. gameOver, when set, tells the players how the game
+// itself ended before any series message goes out. A player whose
+// connection closed after the game forfeits the rest of the series. It
+// reports whether the series is over.
+func (s *Server) AdvanceSeries(g *game.Game, result game.GameResult, gameOver func(seriesOver bool), startNext func(players [2]*game.Player)) bool {
+	players := [2]*game.Player{g.Player1, g.Player2}
+	g.Series.RecordResult(result)
+	seriesOver := g.Series.IsOver()
+	for _, p := range players {
+		if !seriesOver && !p.IsConnected() {
+			log.Printf("Player %s left between games, forfeiting series %s\n", p.GetID(), g.Series.ID)
+			g.Series.Forfeit(p, players)
+			seriesOver = true
+		}
+	}
+	if gameOver != nil {
+		gameOver(seriesOver)
+	}
+	if seriesOver {
+		log.Printf("Series %s between %s and %s is over\n", g.Series.ID, g.Player1.GetID(), g.Player2.GetID())
+		for _, p := range players {
+			p.WriteMessage(game.SeriesOverMessage(g.Series, players))
+		}
+		return true
+	}
+
+	for _, p := range players {
+		p.WriteMessage(game.SeriesProgressMessage(g.Series))
+	}
+	startNext([2]*game.Player{g.Player2, g.Player1})
+	return false
+}
+
 func (s *Server) ListenToGameMessages(g *game.Game, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		select {
 		case <-g.Ctx.Done():
 			{
-				log.Printf("Game between %s and %s ended\n", g.Player1.Identity.ID, g.Player2.Identity.ID)
-				return
+				// the loop posts its final message right before cancelling the game
+				for {
+					select {
+					case msg := <-g.MsgChan:
+						s.HandleGameMessage(g, msg)
+					default:
+						log.Printf("Game between %s and %s ended\n", g.Player1.GetID(), g.Player2.GetID())
+						s.ActiveGames.RemoveGame(g.ID)
+						g.RemoveAllSpectators()
+						return
+					}
+				}
 			}
 		case msg := <-g.MsgChan:
 			{
-				switch m := msg.(type) {
-				case game.LeaveGameMessage:
-					{
-						log.Printf("Player %s left the game\n", m.RequestingPlayer.Identity.ID)
-						s.HandleLeaveGameRequest(m.RequestingPlayer, m.OtherPlayer)
-					}
-				case game.DisconnectedMessage:
-					{
-						log.Printf("Player %s disconnected. Ending game.\n", m.Player.Identity.ID)
-						var otherPlayer *game.Player
-						if m.Player.Identity.ID == g.Player1.Identity.ID {
-							otherPlayer = g.Player2
-						} else {
-							otherPlayer = g.Player1
-						}
-						s.HandleLeaveGameRequest(m.Player, otherPlayer)
-					}
-				case game.InviteGameLoopOverMessage:
-					{
-						log.Printf("Invite Game between %s and %s ended\n", g.Player1.Identity.ID, g.Player2.Identity.ID)
-						s.InviteGameManager.RemoveGame(m.GameID)
-						g := game.NewEmptyInviteGame(*s.Ctx)
-						s.InviteGameManager.AddGame(g)
-						for _, p := range m.Players {
-							p.WriteMessage(game.InviteGameOverMessage(m.Board, m.Winner, g.ID))
-						}
-					}
-				}
+				s.HandleGameMessage(g, msg)
+			}
+		}
+	}
+}
+
+func (s *Server) HandleGameMessage(g *game.Game, msg interface{}) {
+	switch m := msg.(type) {
+	case game.LeaveGameMessage:
+		{
+			log.Printf("Player %s left the game\n", m.RequestingPlayer.GetID())
+			result := g.RateResult(game.GameResult{Winner: m.OtherPlayer, Reason: game.REASON_LEFT})
+			s.SaveReplay(g, result)
+			s.HandleLeaveGameRequest(m.RequestingPlayer, m.OtherPlayer, result)
+		}
+	case game.DisconnectedMessage:
+		{
+			log.Printf("Player %s disconnected. Ending game.\n", m.Player.GetID())
+			var otherPlayer *game.Player
+			if m.Player.GetID() == g.Player1.GetID() {
+				otherPlayer = g.Player2
+			} else {
+				otherPlayer = g.Player1
 			}
+			result := g.RateResult(game.GameResult{Winner: otherPlayer, Reason: game.REASON_DISCONNECTED})
+			s.SaveReplay(g, result)
+			s.HandleLeaveGameRequest(m.Player, otherPlayer, result)
+		}
+	case game.GameLoopOverMessage:
+		{
+			s.SaveReplay(g, m.Result)
+			g.Mode.RouteGameOver(g, m.Result)
 		}
 	}
 }
 
+// Profile returns the public profile of a registered player.
+func (s *Server) Profile(id string) (game.Profile, bool) {
+	i, err := s.IdentityManager.Store.GetIdentity(id)
+	if err != nil {
+		return game.Profile{}, false
+	}
+	return game.NewProfile(i.GetSafeIdentity(), s.Profiles.GetStats(id)), true
+}
+
+// AvatarProgress feeds the player's stats and rating into the avatar unlocks.
+func (s *Server) AvatarProgress(id string) identity.AvatarProgress {
+	progress := identity.AvatarProgress{Wins: s.Profiles.GetStats(id).Wins}
+	if i, err := s.IdentityManager.Store.GetIdentity(id); err == nil {
+		progress.Rating = i.Rating
+	}
+	return progress
+}
+
+// SaveReplay stores the finished game and queues it for analysis.
+func (s *Server) SaveReplay(g *game.Game, result game.GameResult) {
+	replay := g.NewReplay(result)
+	s.Replays.AddReplay(replay)
+	s.Profiles.RecordGame(replay)
+	if len(replay.Moves) == 0 {
+		return
+	}
+	if !s.QueueAnalysis(AnalysisJob{Replay: replay, Players: [2]*game.Player{g.Player1, g.Player2}}) {
+		log.Printf("Analysis queue is full, game %s will not be analysed\n", g.ID)
+	}
+}
+
 func (s *Server) ListenToPlayerMessages(p *game.Player, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		select {
 		case <-p.Ctx.Done():
 			{
-				log.Printf("Player %s context done\n", p.Identity.ID)
+				log.Printf("Player %s context done\n", p.GetID())
 				return
 			}
 		case msg := <-p.ServerMessageChan:
@@ -200,62 +561,152 @@ func (s *Server) ListenToPlayerMessages(p *game.Player, wg *sync.WaitGroup) {
 				switch m := msg.(type) {
 				case game.DisconnectedMessage:
 					{
-						log.Printf("Player %s disconnected\n", p.Identity.ID)
+						log.Printf("Player %s disconnected\n", p.GetID())
+						s.HandleDeclineRematch(p, shared.REMATCH_REASON_LEFT)
+						s.StopSpectating(p)
 						s.Queue.RemovePlayer(p)
-						s.IdentityManager.IdentitiesMap.RemoveIdentity(p.Identity.ID)
 					}
 
 				case game.UpdateIdentityMessage:
 					{
-						valid := s.IdentityManager.IdentitiesMap.UpdateIdentity(m.Content.Identity)
-						if !valid {
-							log.Printf("Player %s tried to update an identity that does not exist\n", p.Identity.ID)
-							log.Printf("message content: ID: %s Secret:%s\n", m.Content.Identity.ID, m.Content.Identity.Secret)
+						updated, err := s.IdentityManager.UpdateIdentity(connectionIdentity(p, m.Content.Identity))
+						if err != nil {
+							log.Printf("Player %s failed to update their identity: %s\n", p.GetID(), err)
+							p.WriteMessage(shared.TypedErrorMessage(identityErrorCode(err), err.Error()))
+							continue
 						}
+						p.UpdateIdentity(updated)
+						p.WriteMessage(shared.IdentityUpdatedMessage(p.GetSafeIdentity()))
 					}
 
 				case shared.JoinInviteGameMessage:
 					{
-						log.Printf("Player %s asked to join a game with id %s\n", p.Identity.ID, msg.(shared.JoinInviteGameMessage).GameID)
+						log.Printf("Player %s asked to join a game with id %s\n", p.GetID(), msg.(shared.JoinInviteGameMessage).GameID)
 						typedMsg, valid := msg.(shared.JoinInviteGameMessage)
 						if !valid {
-							log.Printf("Player %s sent a message of type %s but it is not a JoinInviteGameMessage\n", p.Identity.ID, m.Type)
+							log.Printf("Player %s sent a message of type %s but it is not a JoinInviteGameMessage\n", p.GetID(), m.Type)
 						}
+						s.StopSpectating(p)
+						s.HandleDeclineRematch(p, shared.REMATCH_REASON_LEFT)
 						game, found := s.InviteGameManager.GetGame(typedMsg.GameID)
 						if !found {
-							log.Printf("Player %s asked to join a game with id %s but the game was not found\n", p.Identity.ID, typedMsg.GameID)
+							log.Printf("Player %s asked to join a game with id %s but the game was not found\n", p.GetID(), typedMsg.GameID)
 						}
 
 						if game.Player1 != nil && game.Player2 != nil {
-							log.Printf("Player %s asked to join a game with id %s but the game is full\n", p.Identity.ID, typedMsg.GameID)
+							log.Printf("Player %s asked to join a game with id %s but the game is full\n", p.GetID(), typedMsg.GameID)
 							return
 						}
 
+						if typedMsg.Rated {
+							game.OptInToRating(p)
+						}
 						if game.Player1 != nil {
 							valid = game.AddSecondPlayer(p)
 							if !valid {
-								log.Printf("Player %s asked to join a game with id %s but he is already in the game\n", p.Identity.ID, typedMsg.GameID)
+								log.Printf("Player %s asked to join a game with id %s but he is already in the game\n", p.GetID(), typedMsg.GameID)
 								return
 							}
-							wg.Add(2)
-							go game.InviteGameLoop(wg)
-							go s.ListenToGameMessages(game, wg)
+							if game.BothOptedIn() {
+								game.Rater = &EloRater{Server: s}
+							}
+							s.StartInviteGame(game)
 						} else {
 							game.AddFirstPlayer(p)
 						}
 					}
+				case shared.CreateInviteGameMessage:
+					{
+						config, err := game.NewBoardConfig(m.Content.Rows, m.Content.Cols, m.Content.WinLength)
+						if err != nil {
+							log.Printf("Player %s asked for an invalid board: %s\n", p.GetID(), err)
+							p.WriteMessage(shared.TypedErrorMessage(shared.InvalidBoardConfigErrorCode, err.Error()))
+							continue
+						}
+						rules, err := game.NewRuleSet(m.Content.InitialLives, m.Content.Decay, m.Content.MaxMoves, game.TimeControl{
+							BaseMs:      m.Content.BaseMs,
+							IncrementMs: m.Content.IncrementMs,
+							PerTurnMs:   m.Content.PerTurnMs,
+							Untimed:     m.Content.Untimed,
+						})
+						if err != nil {
+							log.Printf("Player %s asked for invalid rules: %s\n", p.GetID(), err)
+							p.WriteMessage(shared.TypedErrorMessage(shared.InvalidRuleSetErrorCode, err.Error()))
+							continue
+						}
+						bestOf := max(m.Content.BestOf, 1)
+						if err := game.ValidateSeriesLength(bestOf); err != nil {
+							log.Printf("Player %s asked for an invalid series: %s\n", p.GetID(), err)
+							p.WriteMessage(shared.TypedErrorMessage(shared.InvalidSeriesErrorCode, err.Error()))
+							continue
+						}
+						s.StopSpectating(p)
+						s.HandleDeclineRematch(p, shared.REMATCH_REASON_LEFT)
+						inviteGame := game.NewInviteGame(p, config, rules, *s.Ctx)
+						if m.Content.Rated {
+							inviteGame.OptInToRating(p)
+						}
+						if bestOf > 1 {
+							inviteGame.Series = game.NewSeries(bestOf)
+						}
+						s.InviteGameManager.AddGame(inviteGame)
+						log.Printf("Player %s created a game with id %s\n", p.GetID(), inviteGame.ID)
+						p.WriteMessage(shared.InviteGameCreatedMessage(inviteGame.ID))
+					}
+				case shared.GetReplayMessage:
+					{
+						replay, found := s.Replays.GetReplay(m.GameID)
+						if !found {
+							log.Printf("Player %s asked for replay %s but it was not found\n", p.GetID(), m.GameID)
+							p.WriteMessage(shared.TypedErrorMessage(shared.ReplayNotFoundErrorCode, "replay not found"))
+							continue
+						}
+						p.WriteMessage(game.ReplayMessage(replay))
+					}
+				case shared.GetProfileMessage:
+					{
+						profile, found := s.Profile(m.PlayerID)
+						if !found {
+							log.Printf("Player %s asked for profile %s but it was not found\n", p.GetID(), m.PlayerID)
+							p.WriteMessage(shared.TypedErrorMessage(shared.ProfileNotFoundErrorCode, "profile not found"))
+							continue
+						}
+						p.WriteMessage(game.ProfileMessage(profile))
+					}
+				case shared.SpectateGameMessage:
+					{
+						s.HandleSpectateRequest(p, m.GameID)
+					}
+				case shared.PlayVsBotMessage:
+					{
+						difficulty, err := game.ParseBotDifficulty(m.Content.Difficulty)
+						if err != nil {
+							log.Printf("Player %s asked for a bot game: %s\n", p.GetID(), err)
+							p.WriteMessage(shared.TypedErrorMessage(shared.UnknownBotDifficultyErrorCode, err.Error()))
+							continue
+						}
+						if p.GetIsInGame() {
+							log.Printf("Player %s asked for a bot game while in a game\n", p.GetID())
+							p.WriteMessage(shared.TypedErrorMessage(shared.AlreadyInGameErrorCode, "already in a game"))
+							continue
+						}
+						s.Queue.RemovePlayer(p)
+						s.HandleDeclineRematch(p, shared.REMATCH_REASON_LEFT)
+						s.StopSpectating(p)
+						s.StartBotGame(p, difficulty)
+					}
 				case shared.LeaveInviteGameMessage:
 					{
-						log.Printf("Player %s asked to leave a game with id %s\n", p.Identity.ID, msg.(shared.LeaveInviteGameMessage).GameID)
+						log.Printf("Player %s asked to leave a game with id %s\n", p.GetID(), msg.(shared.LeaveInviteGameMessage).GameID)
 						typedMsg, valid := msg.(shared.LeaveInviteGameMessage)
 						if !valid {
-							log.Printf("Player %s sent a message of type %s but it is not a LeaveInviteGameMessage\n", p.Identity.ID, m.Type)
+							log.Printf("Player %s sent a message of type %s but it is not a LeaveInviteGameMessage\n", p.GetID(), m.Type)
 						}
 						s.InviteGameManager.RemoveGame(typedMsg.GameID)
 					}
 				case shared.BaseClientMessage:
 					{
-						log.Printf("Player %s sent a message of type %s\n", p.Identity.ID, m.Type)
+						log.Printf("Player %s sent a message of type %s\n", p.GetID(), m.Type)
 						switch m.Type {
 						case shared.LeaveQueueMessageType:
 							{
@@ -263,25 +714,35 @@ func (s *Server) ListenToPlayerMessages(p *game.Player, wg *sync.WaitGroup) {
 							}
 						case shared.LeaveGameMessageType:
 							{
-								log.Printf("Player %s asked to leave the game but he is not in a game right now!", p.Identity.ID)
+								log.Printf("Player %s asked to leave the game but he is not in a game right now!", p.GetID())
 							}
 						case shared.RequestGameMessageType:
 							{
 								s.HandleRequestGame(p)
 							}
-						case shared.CreateInviteGameMessageType:
+						case shared.RequestRematchMessageType, shared.AcceptRematchMessageType:
+							{
+								s.HandleAcceptRematch(p)
+							}
+						case shared.StopSpectatingMessageType:
+							{
+								s.StopSpectating(p)
+								p.WriteMessage(shared.StoppedSpectatingMessage())
+							}
+						case shared.DeclineRematchMessageType:
+							{
+								s.HandleDeclineRematch(p, shared.REMATCH_REASON_DECLINED)
+							}
+						case shared.RefreshTokenMessageType:
 							{
-								game := game.NewInviteGame(p, *s.Ctx)
-								s.InviteGameManager.AddGame(game)
-								log.Printf("Player %s created a game with id %s\n", p.Identity.ID, game.ID)
-								p.WriteMessage(shared.InviteGameCreatedMessage(game.ID))
+								s.HandleRefreshToken(p)
 							}
 						}
 					}
 
 				default:
 					{
-						log.Println("Unkown message received", m)
+						log.Printf("Unkown message received: %T\n", m)
 					}
 
 				}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Monkhai/strixos-server.git/internal/game"
+	"github.com/Monkhai/strixos-server.git/internal/identity"
+	"github.com/Monkhai/strixos-server.git/pkg/shared"
+)
+
+const (
+	UPGRADE_ID_HEADER     = "X-Strixos-Id"
+	UPGRADE_SECRET_HEADER = "X-Strixos-Secret"
+)
+
+// UpgradeIdentity reads the credentials sent with a websocket upgrade: a
+// session token as "Authorization: Bearer <token>" or the token query
+// parameter, or an id and secret in the X-Strixos-Id and X-Strixos-Secret
+// headers. Browsers cannot set headers on a websocket, hence the token query
+// fallback; the secret is never read from the URL, since URLs end up in
+// proxy and access logs, and a token expires while the secret does not.
+// authenticated is false when no credentials were sent at all; err is set
+// when they were sent but are not valid.
+func (s *Server) UpgradeIdentity(r *http.Request) (i *identity.Identity, authenticated bool, err error) {
+	token := r.URL.Query().Get("token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	id, secret := r.Header.Get(UPGRADE_ID_HEADER), r.Header.Get(UPGRADE_SECRET_HEADER)
+
+	switch {
+	case token != "":
+		{
+			id, err = s.Sessions.Verify(token)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	case id != "" || secret != "":
+		{
+			if _, err := s.IdentityManager.Store.ValidateIdentity(&identity.Identity{ID: id, Secret: secret}); err != nil {
+				return nil, false, err
+			}
+		}
+	default:
+		{
+			return nil, false, nil
+		}
+	}
+
+	stored, err := s.IdentityManager.Store.GetIdentity(id)
+	if err != nil {
+		return nil, false, err
+	}
+	known := *stored
+	return &known, true, nil
+}
+
+// AuthenticateMessage checks a message against the identity p authenticated
+// as during the handshake. A token, when present, must be valid and issued
+// to that identity; without one the message is trusted as coming from the
+// connection, as long as it does not claim to be someone else.
+func (s *Server) AuthenticateMessage(p *game.Player, msg shared.BaseClientMessage) error {
+	if msg.Token != "" {
+		id, err := s.Sessions.Verify(msg.Token)
+		if err != nil {
+			return err
+		}
+		if id != p.GetID() {
+			return identity.ErrInvalidToken
+		}
+		return nil
+	}
+	if msg.Identity.ID != "" && msg.Identity.ID != p.GetID() {
+		return identity.ErrSpoofedIdentity
+	}
+	return nil
+}
+
+// handshakeIdentity returns the identity a player asked to authenticate as.
+// A returning player may prove who they are with a session token instead of
+// the secret, in which case the stored secret is filled in for them.
+func (s *Server) handshakeIdentity(m game.UpdateIdentityMessage) (identity.Identity, error) {
+	requested := m.Content.Identity
+	if m.Content.Token == "" {
+		return requested, nil
+	}
+
+	id, err := s.Sessions.Verify(m.Content.Token)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	stored, err := s.IdentityManager.Store.GetIdentity(id)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	requested.ID = stored.ID
+	requested.Secret = stored.Secret
+	return requested, nil
+}
+
+// connectionIdentity applies an identity update sent over an authenticated
+// connection. The update always targets the connection's own identity.
+func connectionIdentity(p *game.Player, update identity.Identity) identity.Identity {
+	update.ID = p.GetID()
+	update.Secret = p.GetIdentity().Secret
+	update.IsBot = false
+	return update
+}
+
+// canRetryIdentity reports whether the player can fix the update that was
+// refused and send it again, as opposed to failing to authenticate.
+func canRetryIdentity(err error) bool {
+	return errors.Is(err, identity.ErrInvalidDisplayName) ||
+		errors.Is(err, identity.ErrOffensiveDisplayName) ||
+		errors.Is(err, identity.ErrAvatarLocked)
+}
+
+func identityErrorCode(err error) shared.ErrorCode {
+	switch {
+	case errors.Is(err, identity.ErrInvalidDisplayName):
+		return shared.InvalidDisplayNameErrorCode
+	case errors.Is(err, identity.ErrOffensiveDisplayName):
+		return shared.OffensiveDisplayNameErrorCode
+	case errors.Is(err, identity.ErrAvatarLocked):
+		return shared.AvatarLockedErrorCode
+	default:
+		return shared.UnauthorizedErrorCode
+	}
+}
+
+func (s *Server) HandleRefreshToken(p *game.Player) {
+	p.WriteMessage(shared.SessionTokenMessage(s.Sessions.Issue(p.GetID())))
+}
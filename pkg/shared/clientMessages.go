@@ -12,17 +12,77 @@ const (
 	JoinInviteGameMessageType   MessageType = "joinInviteGame"
 	CreateInviteGameMessageType MessageType = "createInviteGame"
 	LeaveInviteGameMessageType  MessageType = "leaveInviteGame"
+	RequestRematchMessageType   MessageType = "requestRematch"
+	AcceptRematchMessageType    MessageType = "acceptRematch"
+	DeclineRematchMessageType   MessageType = "declineRematch"
+	PlayVsBotMessageType        MessageType = "playVsBot"
+	SpectateGameMessageType     MessageType = "spectateGame"
+	StopSpectatingMessageType   MessageType = "stopSpectating"
+	GetReplayMessageType        MessageType = "getReplay"
+	RequestHintMessageType      MessageType = "requestHint"
+	RefreshTokenMessageType     MessageType = "refreshToken"
+	GetProfileMessageType       MessageType = "getProfile"
 	UnknownMessageType          MessageType = "unknownMessage"
 )
 
+// BaseClientMessage is the envelope of every client message. Once the
+// connection is authenticated, messages may carry a session token instead of
+// the identity; a bare message is trusted as coming from the connection's
+// identity.
 type BaseClientMessage struct {
 	Type     MessageType       `json:"type"`
 	Identity identity.Identity `json:"identity"`
+	Token    string            `json:"token,omitempty"`
 }
 
+// JoinInviteGameMessage joins an invite game. Rated opts in to a rated game;
+// it only counts when the other player opted in as well.
 type JoinInviteGameMessage struct {
 	BaseClientMessage
 	GameID string `json:"gameID"`
+	Rated  bool   `json:"rated"`
+}
+
+// CreateInviteGameMessage lets the creator pick the board and rules. Omitted
+// fields use the server defaults.
+type CreateInviteGameMessage struct {
+	BaseClientMessage
+	Content struct {
+		Rows         int    `json:"rows"`
+		Cols         int    `json:"cols"`
+		WinLength    int    `json:"winLength"`
+		InitialLives int    `json:"initialLives"`
+		Decay        string `json:"decay"`
+		MaxMoves     int    `json:"maxMoves"`
+		BaseMs       int64  `json:"baseMs"`
+		IncrementMs  int64  `json:"incrementMs"`
+		PerTurnMs    int64  `json:"perTurnMs"`
+		Untimed      bool   `json:"untimed"`
+		BestOf       int    `json:"bestOf"`
+		Rated        bool   `json:"rated"`
+	} `json:"content"`
+}
+
+type PlayVsBotMessage struct {
+	BaseClientMessage
+	Content struct {
+		Difficulty string `json:"difficulty"`
+	} `json:"content"`
+}
+
+type SpectateGameMessage struct {
+	BaseClientMessage
+	GameID string `json:"gameID"`
+}
+
+type GetReplayMessage struct {
+	BaseClientMessage
+	GameID string `json:"gameID"`
+}
+
+type GetProfileMessage struct {
+	BaseClientMessage
+	PlayerID string `json:"playerID"`
 }
 
 type LeaveInviteGameMessage struct {
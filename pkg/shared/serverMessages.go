@@ -13,12 +13,67 @@ const (
 	RemovedFromQueueMessageType       MessageType = "removedFromQueue"
 	RemovedFromGameMessageType        MessageType = "removedFromGame"
 	OpponentDisconnectedMessageType   MessageType = "opponentDisconnected"
+	OpponentReconnectingMessageType   MessageType = "opponentReconnecting"
+	OpponentReconnectedMessageType    MessageType = "opponentReconnected"
+	ResyncGameMessageType             MessageType = "resync"
 	DisconnectedFromServerMessageType MessageType = "disconnectedFromServer"
 	//register flow
-	AuthIdentityMessageType MessageType = "authIdentity"
-	RegisteredMessageType   MessageType = "registered"
+	AuthIdentityMessageType    MessageType = "authIdentity"
+	RegisteredMessageType      MessageType = "registered"
+	SessionTokenMessageType    MessageType = "sessionToken"
+	IdentityUpdatedMessageType MessageType = "identityUpdated"
 	//invite game flow
 	InviteGameCreatedMessageType MessageType = "inviteGameCreated"
+	//rematch flow
+	RematchRequestedMessageType MessageType = "rematchRequested"
+	RematchDeclinedMessageType  MessageType = "rematchDeclined"
+	RematchExpiredMessageType   MessageType = "rematchExpired"
+	//series flow
+	SeriesProgressMessageType MessageType = "seriesProgress"
+	SeriesOverMessageType     MessageType = "seriesOver"
+	//spectator flow
+	SpectatorsUpdateMessageType  MessageType = "spectatorsUpdate"
+	StoppedSpectatingMessageType MessageType = "stoppedSpectating"
+	//replays
+	ReplayMessageType       MessageType = "replay"
+	GameAnalysisMessageType MessageType = "gameAnalysis"
+	//hints
+	HintMessageType MessageType = "hint"
+	//profiles
+	ProfileMessageType MessageType = "profile"
+)
+
+const (
+	REMATCH_REASON_DECLINED = "declined"
+	REMATCH_REASON_LEFT     = "left"
+	REMATCH_REASON_IN_GAME  = "inGame"
+)
+
+type ErrorCode string
+
+const (
+	InvalidMarkErrorCode          ErrorCode = "invalidMark"
+	InvalidMoveErrorCode          ErrorCode = "invalidMove"
+	InvalidBoardConfigErrorCode   ErrorCode = "invalidBoardConfig"
+	InvalidRuleSetErrorCode       ErrorCode = "invalidRuleSet"
+	NoRematchErrorCode            ErrorCode = "noRematch"
+	InvalidSeriesErrorCode        ErrorCode = "invalidSeries"
+	UnknownBotDifficultyErrorCode ErrorCode = "unknownBotDifficulty"
+	AlreadyInGameErrorCode        ErrorCode = "alreadyInGame"
+	GameNotFoundErrorCode         ErrorCode = "gameNotFound"
+	SpectatorCannotMoveErrorCode  ErrorCode = "spectatorCannotMove"
+	ReplayNotFoundErrorCode       ErrorCode = "replayNotFound"
+	HintsNotAllowedErrorCode      ErrorCode = "hintsNotAllowed"
+	NotYourTurnErrorCode          ErrorCode = "notYourTurn"
+	NoHintAvailableErrorCode      ErrorCode = "noHintAvailable"
+	HintAlreadyUsedErrorCode      ErrorCode = "hintAlreadyUsed"
+	NotInGameErrorCode            ErrorCode = "notInGame"
+	UnauthorizedErrorCode         ErrorCode = "unauthorized"
+	TokenExpiredErrorCode         ErrorCode = "tokenExpired"
+	InvalidDisplayNameErrorCode   ErrorCode = "invalidDisplayName"
+	OffensiveDisplayNameErrorCode ErrorCode = "offensiveDisplayName"
+	AvatarLockedErrorCode         ErrorCode = "avatarLocked"
+	ProfileNotFoundErrorCode      ErrorCode = "profileNotFound"
 )
 
 var DisconnectedFromServerMessage = GenericMessage{
@@ -29,15 +84,29 @@ var OpponentDisconnectedMessage = GenericMessage{
 	Type: OpponentDisconnectedMessageType,
 }
 
+var OpponentReconnectedMessage = GenericMessage{
+	Type: OpponentReconnectedMessageType,
+}
+
 var RemovedFromQueueMessage = GenericMessage{
 	Type: RemovedFromQueueMessageType,
 }
 
-func InitialIdentityMessage(identity identity.InitialIdentity) GenericMessage {
+func InitialIdentityMessage(initial identity.InitialIdentity, avatars []identity.Avatar) GenericMessage {
 	return GenericMessage{
 		Type: AuthIdentityMessageType,
 		Content: map[string]any{
-			"identity": identity,
+			"identity": initial,
+			"avatars":  avatars,
+		},
+	}
+}
+
+func OpponentReconnectingMessage(graceMs int64) GenericMessage {
+	return GenericMessage{
+		Type: OpponentReconnectingMessageType,
+		Content: map[string]any{
+			"graceMs": graceMs,
 		},
 	}
 }
@@ -51,11 +120,35 @@ func InviteGameCreatedMessage(gameID string) GenericMessage {
 	}
 }
 
-func RegistedMesage(identity *identity.Identity) GenericMessage {
+// RegistedMesage confirms the handshake. It never echoes the secret; the
+// session token is what the client uses from here on. The avatar catalog is
+// included because clients that authenticate during the upgrade never see
+// the authIdentity message.
+func RegistedMesage(identity *identity.SafeIdentity, session identity.SessionToken, avatars []identity.Avatar) GenericMessage {
 	return GenericMessage{
 		Type: RegisteredMessageType,
 		Content: map[string]any{
 			"identity": identity,
+			"session":  session,
+			"avatars":  avatars,
+		},
+	}
+}
+
+func IdentityUpdatedMessage(identity *identity.SafeIdentity) GenericMessage {
+	return GenericMessage{
+		Type: IdentityUpdatedMessageType,
+		Content: map[string]any{
+			"identity": identity,
+		},
+	}
+}
+
+func SessionTokenMessage(session identity.SessionToken) GenericMessage {
+	return GenericMessage{
+		Type: SessionTokenMessageType,
+		Content: map[string]any{
+			"session": session,
 		},
 	}
 }
@@ -69,6 +162,16 @@ func ErrorMessage(message string) GenericMessage {
 	}
 }
 
+func TypedErrorMessage(code ErrorCode, message string) GenericMessage {
+	return GenericMessage{
+		Type: ErrorMessageType,
+		Content: map[string]any{
+			"code":    code,
+			"message": message,
+		},
+	}
+}
+
 func GameWaitingMessage() GenericMessage {
 	return GenericMessage{
 		Type: GameWaitingMessageType,
@@ -86,3 +189,42 @@ func RemovedFromGameMessage() GenericMessage {
 		Type: RemovedFromGameMessageType,
 	}
 }
+
+func RematchRequestedMessage(opponent *identity.SafeIdentity) GenericMessage {
+	return GenericMessage{
+		Type: RematchRequestedMessageType,
+		Content: map[string]any{
+			"opponent": opponent,
+		},
+	}
+}
+
+func RematchDeclinedMessage(reason string) GenericMessage {
+	return GenericMessage{
+		Type: RematchDeclinedMessageType,
+		Content: map[string]any{
+			"reason": reason,
+		},
+	}
+}
+
+func RematchExpiredMessage() GenericMessage {
+	return GenericMessage{
+		Type: RematchExpiredMessageType,
+	}
+}
+
+func SpectatorsUpdateMessage(count int) GenericMessage {
+	return GenericMessage{
+		Type: SpectatorsUpdateMessageType,
+		Content: map[string]any{
+			"spectators": count,
+		},
+	}
+}
+
+func StoppedSpectatingMessage() GenericMessage {
+	return GenericMessage{
+		Type: StoppedSpectatingMessageType,
+	}
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WriteFileAtomic replaces the file at path with data. The data goes to a
+// fresh temporary file in the same directory, is synced to disk and then
+// renamed over path, so readers see either the old file or the new one and
+// never a partial write. Concurrent calls do not share a temporary file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// a no-op once the rename went through
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// AtomicFile is a file that is always rewritten whole. Save holds a lock from
+// encoding to rename, so saves land in the order they were made and an older
+// encoding never overwrites a newer one.
+type AtomicFile struct {
+	Path string
+	Perm os.FileMode
+	Mux  *sync.Mutex
+}
+
+func NewAtomicFile(path string, perm os.FileMode) *AtomicFile {
+	return &AtomicFile{
+		Path: path,
+		Perm: perm,
+		Mux:  &sync.Mutex{},
+	}
+}
+
+// Save encodes the current contents with encode and writes them to Path.
+func (a *AtomicFile) Save(encode func() ([]byte, error)) error {
+	a.Mux.Lock()
+	defer a.Mux.Unlock()
+	data, err := encode()
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(a.Path, data, a.Perm)
+}